@@ -0,0 +1,88 @@
+package pqutil
+
+// Column describes a column of a Relation (or a field of a Record)
+type Column struct {
+	k       Valstructor // the Value kind
+	typ     string      // the pg_type name for casting
+	oid     uint32      // the pg_type oid (if available)
+	name    string      // name of this col
+	num     int         // attnum (ordinal position)
+	pk      bool        // is col a primary key
+	notNull bool        // is col marked as notNull
+	hasDef  bool        // does col have a DEFAULT
+	def     string      // the DEFAULT expression
+	comment string      // COMMENT ON COLUMN text
+	fkRel   string      // referenced relation (if a foreign key)
+	fkCol   string      // referenced col (if a foreign key)
+	dom     *domain     // the domain (if col type is a domain or array of one)
+	// values are hidden from String(), hooks and errors
+	sensitive bool
+}
+
+// return the column name
+func (c *Column) Name() string {
+	return c.name
+}
+
+// return the SQL type as given by format_type ie. "character varying(5)"
+func (c *Column) Type() string {
+	return c.typ
+}
+
+// return the pg_type oid of the column (0 for Cols not from the db)
+func (c *Column) OID() uint32 {
+	return c.oid
+}
+
+// can the column be NULL
+func (c *Column) Nullable() bool {
+	return !c.notNull
+}
+
+// return the DEFAULT expression or "" if none
+func (c *Column) Default() string {
+	return c.def
+}
+
+// is the column (part of) the primary key
+func (c *Column) PrimaryKey() bool {
+	return c.pk
+}
+
+// return the relation and column referenced by a foreign key
+// on this column or empty strings if it is not a foreign key.
+// If there are many foreign keys on the column the first
+// (by constraint name) is returned
+func (c *Column) References() (rel string, col string) {
+	return c.fkRel, c.fkCol
+}
+
+// return the COMMENT ON COLUMN text or "" if none
+func (c *Column) Comment() string {
+	return c.comment
+}
+
+// return the ordinal position (attnum) of the column in the table.
+// Dropped columns leave gaps so this may not match the index in Cols()
+func (c *Column) Position() int {
+	return c.num
+}
+
+// return the name of the domain the column's type is
+// (or is an array of) or "" if it is not a domain
+func (c *Column) Domain() string {
+	if c.dom == nil {
+		return ""
+	}
+	return c.dom.name
+}
+
+// return the Valstructor used to create Values for the column
+func (c *Column) Valstructor() Valstructor {
+	return c.k
+}
+
+// is the column marked as sensitive (see MarkSensitive)
+func (c *Column) Sensitive() bool {
+	return c.sensitive
+}
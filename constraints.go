@@ -0,0 +1,139 @@
+package pqutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the kind of a Constraint (or the one violated in a ConstraintError)
+type ConstraintKind string
+
+const (
+	ConstraintPrimaryKey ConstraintKind = "primary key"
+	ConstraintUnique     ConstraintKind = "unique"      // SQLSTATE 23505
+	ConstraintForeignKey ConstraintKind = "foreign key" // SQLSTATE 23503
+	ConstraintNotNull    ConstraintKind = "not null"    // SQLSTATE 23502
+	ConstraintCheck      ConstraintKind = "check"       // SQLSTATE 23514
+	ConstraintExclude    ConstraintKind = "exclude"     // SQLSTATE 23P01
+)
+
+// map of pg_constraint.contype to kind
+var contypes = map[string]ConstraintKind{
+	"p": ConstraintPrimaryKey,
+	"u": ConstraintUnique,
+	"f": ConstraintForeignKey,
+	"c": ConstraintCheck,
+	"x": ConstraintExclude,
+}
+
+// Constraint describes a table constraint introspected from pg_constraint
+type Constraint struct {
+	name       string
+	kind       ConstraintKind
+	cols       []*Column
+	def        string
+	deferrable bool
+	deferred   bool
+	terms      []*checkTerm // the parts of a CHECK we can evaluate client side
+}
+
+// return the constraint name
+func (con *Constraint) Name() string {
+	return con.name
+}
+
+// return the kind of constraint
+func (con *Constraint) Kind() ConstraintKind {
+	return con.kind
+}
+
+// return the names of the constrained cols in key order.
+// For CHECK constraints these are the cols used by the expression
+func (con *Constraint) Cols() []string {
+	names := make([]string, len(con.cols))
+	for i, c := range con.cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+// return the definition as given by pg_get_constraintdef
+// ie. "UNIQUE (email)" or "CHECK ((age >= 0))"
+func (con *Constraint) Def() string {
+	return con.def
+}
+
+// is the constraint DEFERRABLE
+func (con *Constraint) Deferrable() bool {
+	return con.deferrable
+}
+
+// is the constraint INITIALLY DEFERRED
+func (con *Constraint) InitiallyDeferred() bool {
+	return con.deferred
+}
+
+// return all the constraints on the relation ordered by name
+func (r *Relation) Constraints() []*Constraint {
+	return r.cons
+}
+
+// return the named constraint or nil if none
+func (r *Relation) Constraint(name string) *Constraint {
+	for _, con := range r.cons {
+		if con.name == name {
+			return con
+		}
+	}
+	return nil
+}
+
+// return the primary key and unique constraints. Any of these
+// are suitable as an ON CONFLICT target
+func (r *Relation) UniqueConstraints() []*Constraint {
+	cons := make([]*Constraint, 0)
+	for _, con := range r.cons {
+		if con.kind == ConstraintPrimaryKey || con.kind == ConstraintUnique {
+			cons = append(cons, con)
+		}
+	}
+	return cons
+}
+
+// return list of constraints for a pg_class oid
+func (db *DB) constraints(r *Relation, reloid uint32) ([]*Constraint, error) {
+	rows, err := db.getCons.Query(reloid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cons := make([]*Constraint, 0)
+	for rows.Next() {
+		con := new(Constraint)
+		var contype, names string
+		err = rows.Scan(&con.name, &contype, &names, &con.def,
+			&con.deferrable, &con.deferred)
+		if err != nil {
+			return nil, err
+		}
+		con.kind = contypes[contype]
+		if names != "" {
+			for _, name := range strings.Split(names, ",") {
+				c := r.col(name)
+				if c == nil {
+					return nil, fmt.Errorf("expected to find col %s for constraint %s", name, con.name)
+				}
+				con.cols = append(con.cols, c)
+			}
+		}
+		if con.kind == ConstraintCheck {
+			con.terms = parseCheck(con.def)
+		}
+		cons = append(cons, con)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return cons, rows.Close()
+}
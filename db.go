@@ -2,6 +2,8 @@ package pqutil
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -22,7 +24,7 @@ const (
 		AND pgn.nspname = 'public'
 	`
 	// SQL to fetch col info for a relation
-	// along with foreign key data notnull, primary key info
+	// along with notnull, primary key info
 	selectColsSql = `
 		SELECT DISTINCT
 			a.attnum as num,
@@ -33,9 +35,8 @@ const (
 			) as typ,
 			a.atttypid as toid,
 			a.attnotnull as notnull,
+			a.atthasdef as hasdef,
 			COALESCE(i.indisprimary,false) as pk,
-			COALESCE(fks.fktable, ''),
-			COALESCE(fks.fkfield, ''),
 			COALESCE(regexp_replace(
 				regexp_replace(
 					format_type(a.atttypid, a.atttypmod),
@@ -44,42 +45,82 @@ const (
 				),
 				E'\\).*',
 				''
-			),'') as args
+			),'') as args,
+			COALESCE(col_description(a.attrelid, a.attnum), '') as comment,
+			COALESCE(pg_get_expr(d.adbin, d.adrelid), '') as def
 		FROM pg_attribute a JOIN pg_class pgc ON pgc.oid = a.attrelid
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
 		LEFT JOIN pg_index i ON pgc.oid = i.indrelid AND i.indkey[0] = a.attnum AND i.indisprimary=TRUE
-		LEFT JOIN (
-			select
-				att2.attname as name,
-				cl.relname as fktable,
-				att.attname as fkfield,
-				con.relname as relname
-			from
-				(select
-					unnest(con1.conkey) as "parent",
-					unnest(con1.confkey) as "child",
-					con1.confrelid,
-					con1.conrelid,
-					cl.relname as relname
-				from
-					pg_class cl
-					join pg_namespace ns on cl.relnamespace = ns.oid
-					join pg_constraint con1 on con1.conrelid = cl.oid
-				where
-					con1.contype = 'f'
-				) con
-			join pg_attribute att on
-				att.attrelid = con.confrelid and att.attnum = con.child
-			join pg_class cl on
-				cl.oid = con.confrelid
-			join pg_attribute att2 on
-				att2.attrelid = con.conrelid and att2.attnum = con.parent
-		) fks ON fks.name = a.attname AND fks.relname = pgc.relname
 		WHERE a.attnum > 0 AND pgc.oid = a.attrelid
 		AND pgc.oid = $1
 		AND pg_table_is_visible(pgc.oid)
 		AND NOT a.attisdropped
 		ORDER BY a.attnum
 	`
+	// SQL to fetch the foreign key constraints for a relation
+	// with the local and referenced column names listed in key order
+	selectFKeysSql = `
+		SELECT
+			con.conname,
+			fcl.relname,
+			array_to_string(ARRAY(
+				SELECT att.attname
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(num, idx)
+				JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.num
+				ORDER BY k.idx
+			), ','),
+			array_to_string(ARRAY(
+				SELECT att.attname
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(num, idx)
+				JOIN pg_attribute att ON att.attrelid = con.confrelid AND att.attnum = k.num
+				ORDER BY k.idx
+			), ',')
+		FROM pg_constraint con JOIN pg_class fcl ON fcl.oid = con.confrelid
+		WHERE con.contype = 'f'
+		AND con.conrelid = $1
+		ORDER BY con.conname
+	`
+	// SQL to fetch the table constraints for a relation
+	// with the constrained column names listed in key order
+	selectConsSql = `
+		SELECT
+			con.conname,
+			con.contype,
+			array_to_string(ARRAY(
+				SELECT att.attname
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(num, idx)
+				JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.num
+				ORDER BY k.idx
+			), ','),
+			pg_get_constraintdef(con.oid),
+			con.condeferrable,
+			con.condeferred
+		FROM pg_constraint con
+		WHERE con.contype IN ('p', 'u', 'f', 'c', 'x')
+		AND con.conrelid = $1
+		ORDER BY con.conname
+	`
+	// SQL to fetch the indexes for a relation with each key
+	// column (or expression) listed in key order
+	selectIndexesSql = `
+		SELECT
+			ic.relname,
+			am.amname,
+			i.indisunique,
+			i.indisprimary,
+			ARRAY(
+				SELECT pg_get_indexdef(i.indexrelid, k.n, true)
+				FROM generate_series(1, i.indnkeyatts) AS k(n)
+				ORDER BY k.n
+			),
+			COALESCE(pg_get_expr(i.indpred, i.indrelid, true), ''),
+			pg_get_indexdef(i.indexrelid)
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_am am ON am.oid = ic.relam
+		WHERE i.indrelid = $1
+		ORDER BY ic.relname
+	`
 	// SQL to list pg_type info
 	selectTypeSql = `
 		SELECT
@@ -92,12 +133,28 @@ const (
 			typnotnull,
 			typbasetype,
 			typtypmod,
-			typndims
+			typndims,
+			CASE WHEN typtype = 'd'
+				THEN format_type(typbasetype, typtypmod)
+				ELSE ''
+			END,
+			(SELECT nspname FROM pg_namespace WHERE oid = typnamespace)
 		FROM pg_type
 		WHERE oid = $1
 		AND typisdefined = true
 	`
 
+	// SQL to fetch the CHECK constraints of a domain
+	selectDomainChecksSql = `
+		SELECT
+			conname,
+			pg_get_constraintdef(oid)
+		FROM pg_constraint
+		WHERE contypid = $1
+		AND contype = 'c'
+		ORDER BY conname
+	`
+
 	// SQL to fetch list of enum labels
 	selectEnumSql = `
 		SELECT enumlabel
@@ -110,17 +167,8 @@ const (
 type queryer interface {
 	Query(string, ...interface{}) (*Rows, error)
 	Relations() (map[string]*Relation, error)
-}
-
-type col struct {
-	k       Valstructor // the Value kind
-	typ     string      // the pg_type name for casting
-	oid     uint32      // the pg_type oid (if available)
-	name    string      // name of this col
-	reft    string      // name of referenced relation (if any)
-	reff    string      // name of field in referenced relation (if any)
-	pk      bool        // is col a primary key
-	notNull bool        // is col marked as notNull
+	// like Query but describes the op and relation for any hooks
+	query(Op, *Relation, string, ...interface{}) (*Rows, error)
 }
 
 type refkind uint
@@ -128,23 +176,47 @@ type refkind uint
 const (
 	r_hasOne = iota
 	r_hasMany
+	r_hasManyThrough
 )
 
+// struct to hold foreign key constraint info on *Relation
+type fkey struct {
+	name  string    // constraint name
+	reft  string    // name of referenced relation
+	cols  []*Column // local columns in key order
+	fcols []string  // names of referenced columns in key order
+}
+
+// names of the local columns in key order
+func (fk *fkey) names() []string {
+	names := make([]string, len(fk.cols))
+	for i, c := range fk.cols {
+		names[i] = c.name
+	}
+	return names
+}
+
 // struct to hold foreign reference info on *Relation
 type ref struct {
 	name string    // relationship name
 	kind refkind   //relationship type
 	rel  *Relation // relation
-	col  *col      // column with foreign key details
+	fk   *fkey     // foreign key details
+	via  *Relation // join relation (has many through only)
+	vfk  *fkey     // foreign key in via that references the owner of this ref
 }
 
 // Relation holds column and reference info about a relation.
 // Usually inferred from the database. See Relation methods on DB
 type Relation struct {
-	Name string
-	k    Valstructor
-	cols []*col
-	refs []*ref
+	Name  string
+	k     Valstructor
+	cols  []*Column
+	refs  []*ref
+	fkeys []*fkey
+	cons  []*Constraint
+	idxs  []*Index
+	db    *DB // the db this relation was loaded from
 }
 
 // return a new RecordValue that represents a row
@@ -210,7 +282,7 @@ func (r *Relation) bindings(pk bool, set bool) (string, int) {
 }
 
 // return the primary key col or nil if none
-func (r *Relation) pk() *col {
+func (r *Relation) pk() *Column {
 	if r.cols == nil {
 		return nil
 	}
@@ -223,40 +295,92 @@ func (r *Relation) pk() *col {
 }
 
 // Return a slice of all values from v.
-// If update is true then move pk to end of list.
-// If update is false then skip pk.
-func (r *Relation) valArgs(v RecordValue, update bool) []interface{} {
+// If pk is true then the pk is included in col order.
+// Otherwise if update is true then move pk to end of list,
+// and if update is false then skip pk.
+func (r *Relation) valArgs(v RecordValue, pk bool, update bool) []interface{} {
 	n := len(r.cols)
-	if !update {
+	if !update && !pk {
 		n--
 	}
 	infs := make([]interface{}, n)
 	i := 0
-	var pk *col
+	var pkc *Column
 	for _, c := range r.cols {
-		if c.pk {
-			pk = c
+		if c.pk && !pk {
+			pkc = c
 			continue
 		}
-		infs[i] = v.ValueBy(c.name)
+		infs[i] = hide(c, v.ValueBy(c.name))
 		i++
 	}
-	if update {
-		infs[i] = v.ValueBy(pk.name)
+	if update && pkc != nil {
+		infs[i] = v.ValueBy(pkc.name)
 		i++
 	}
 	return infs
 }
 
+// return the named col or nil if none
+func (r *Relation) col(name string) *Column {
+	for _, c := range r.cols {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// return the named reference or nil if none
+func (r *Relation) refBy(name string) *ref {
+	for _, ref := range r.refs {
+		if ref.name == name {
+			return ref
+		}
+	}
+	return nil
+}
+
 // return list of column data in the order postgresql expects them
-func (r *Relation) Cols() []*col {
+func (r *Relation) Cols() []*Column {
 	return r.cols
 }
 
+// return the named Column or nil if none
+func (r *Relation) Column(name string) *Column {
+	return r.col(name)
+}
+
 // wrapper type around sql.Rows
 // adds the ScanRecord method to make it easier to Scan Row Values
 type Rows struct {
 	*sql.Rows
+	n     int64       // rows read so far
+	event *QueryEvent // pending hook event (if any)
+	hooks []Hook
+}
+
+// same as sql.Rows#Next but keeps count of the rows read for any hooks and
+// completes any hook event once the rows are exhausted
+func (rs *Rows) Next() bool {
+	ok := rs.Rows.Next()
+	if ok {
+		rs.n++
+	} else {
+		rs.after(rs.Rows.Err())
+	}
+	return ok
+}
+
+// same as sql.Rows#Close but also completes any hook event
+func (rs *Rows) Close() error {
+	rerr := rs.Rows.Err()
+	err := rs.Rows.Close()
+	if rerr == nil {
+		rerr = err
+	}
+	rs.after(rerr)
+	return err
 }
 
 // Similar to sql.Rows#Scan but scans all values into a RecordValue
@@ -277,14 +401,22 @@ func (rs *Rows) ScanRecord(v RecordValue) error {
 // most methods return a new Query so they can be chained
 // with any errors being defered until a call that causes a db.Query
 type Query struct {
-	tx          queryer
-	from        *Relation
-	where       []string
-	whereParams []interface{}
-	order       string
-	limit       int
-	offset      int
-	err         error // some errors are defered until a call the Fetch(), Update() etc
+	tx           queryer
+	from         *Relation
+	with         []*cte
+	sel          []*Column
+	where        []string
+	whereParams  []interface{}
+	distinct     bool
+	distinctOn   []string
+	group        []string
+	having       []string
+	havingParams []interface{}
+	order        []string
+	reverse      bool // flip the order and the results (see Before)
+	limit        int
+	offset       int
+	err          error // some errors are defered until a call the Fetch(), Update() etc
 }
 
 func (q *Query) cp() *Query {
@@ -293,16 +425,17 @@ func (q *Query) cp() *Query {
 	if q.err != nil {
 		panic("cp should not be called when there is a pending error")
 	}
-	return &Query{
-		q.tx,
-		q.from,
-		q.where,
-		q.whereParams,
-		q.order,
-		q.limit,
-		q.offset,
-		q.err,
-	}
+	q2 := *q
+	// copy the slices that get appended to so that queries
+	// built from the same base do not share backing arrays
+	q2.where = append([]string(nil), q.where...)
+	q2.whereParams = append([]interface{}(nil), q.whereParams...)
+	q2.distinctOn = append([]string(nil), q.distinctOn...)
+	q2.group = append([]string(nil), q.group...)
+	q2.having = append([]string(nil), q.having...)
+	q2.havingParams = append([]interface{}(nil), q.havingParams...)
+	q2.order = append([]string(nil), q.order...)
+	return &q2
 }
 
 // Return a new Query based on this query with an additional
@@ -313,10 +446,86 @@ func (q *Query) Where(w string, params ...interface{}) *Query {
 	}
 	q2 := q.cp()
 	q2.where = append(q2.where, w)
-	q2.whereParams = append(q2.whereParams, params...)
+	q2.whereParams = append(q2.whereParams, hideParams(q.from, w, params)...)
 	return q2
 }
 
+// Return a new Query with an additional "name IN (subquery)" filter.
+// sub's params are merged into this Query's params.
+// ie db.From("orders").WhereIn("customer_id", customers.Select("id"))
+func (q *Query) WhereIn(name string, sub *Query) *Query {
+	if q.err != nil {
+		return q
+	}
+	s, args, err := sub.ToSQL()
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.Where(fmt.Sprintf(`%s IN (%s)`, name, s), args...)
+}
+
+// Return a new Query with an additional "EXISTS (subquery)" filter.
+// sub can refer to this Query's relation by name to correlate them.
+// ie db.From("location").WhereExists(db.From("person").Where("location_id = location.id"))
+func (q *Query) WhereExists(sub *Query) *Query {
+	if q.err != nil {
+		return q
+	}
+	s, args, err := sub.ToSQL()
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.Where(fmt.Sprintf(`EXISTS (%s)`, s), args...)
+}
+
+// Return a new Query that only SELECTs the named cols.
+// Mostly useful for building subqueries (see WhereIn and DB.With).
+// RecordValues fetched with only some of the cols do not belong to the Relation
+func (q *Query) Select(names ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.sel = make([]*Column, len(names))
+	for i, name := range names {
+		c := q.from.col(name)
+		if c == nil {
+			q2.err = fmt.Errorf("could not SELECT %w name: %s", ErrUnknownColumn, name)
+			return q2
+		}
+		q2.sel[i] = c
+	}
+	return q2
+}
+
+// names of the selected cols
+func (q *Query) selNames() []string {
+	names := make([]string, len(q.sel))
+	for i, c := range q.sel {
+		names[i] = c.name
+	}
+	return names
+}
+
+// create a Relation describing the rows returned by this Query
+// for use as a common table expression (see DB.With)
+func (q *Query) relation(name string) *Relation {
+	cols := q.sel
+	if len(cols) == 0 {
+		cols = q.from.cols
+	}
+	r := new(Relation)
+	r.Name = name
+	r.cols = cols
+	r.k = Record(cols...)
+	r.db = q.from.db
+	return r
+}
+
 // syntantic sugar alias for Where
 func (q *Query) And(w string, params ...interface{}) *Query {
 	return q.Where(w, params...)
@@ -327,64 +536,148 @@ func (q *Query) For(v RecordValue) *Query {
 	if q.err != nil {
 		return q
 	}
-	q2 := q.cp()
 	// get the pk for v
 	vrel := v.Relation()
 	if vrel == nil {
+		q2 := q.cp()
 		q2.err = fmt.Errorf("RecordValue given to For() does not belong to a relation")
 		return q2
 	}
-	// check for a ref on this query's rel to use (has one)
-	// select * from x where id = v.fk
-	if ref := q.refFor(r_hasOne, q.from, vrel); ref != nil {
-		fkv := v.ValueBy(ref.col.name)
-		if fkv == nil {
-			q2.err = fmt.Errorf("No column %s for %s", ref.col.name, vrel.Name)
+	// check for a ref on v that points to this query's rel (has one / has many)
+	// falling back to a join relation between them (has many through)
+	refs := q.refsFor(q.from, vrel, r_hasOne, r_hasMany)
+	if len(refs) == 0 {
+		refs = q.refsFor(q.from, vrel, r_hasManyThrough)
+	}
+	switch len(refs) {
+	case 0:
+		q2 := q.cp()
+		q2.err = fmt.Errorf("No reference columns between %s and %s", q.from.Name, vrel.Name)
+		return q2
+	case 1:
+		return q.forRef(v, refs[0])
+	}
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.name
+	}
+	q2 := q.cp()
+	q2.err = fmt.Errorf("Ambiguous reference between %s and %s use ForRef with one of: %s",
+		q.from.Name, vrel.Name, strings.Join(names, ","))
+	return q2
+}
+
+// Return a new Query filtered by the named reference on v's Relation.
+// Use this rather than For when there are multiple references between
+// the relations. ie db.From("locate").ForRef(person, "locate_a")
+func (q *Query) ForRef(v RecordValue, name string) *Query {
+	if q.err != nil {
+		return q
+	}
+	vrel := v.Relation()
+	if vrel == nil {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("RecordValue given to ForRef() does not belong to a relation")
+		return q2
+	}
+	ref := vrel.refBy(name)
+	if ref == nil || ref.rel != q.from {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("No reference %s between %s and %s", name, q.from.Name, vrel.Name)
+		return q2
+	}
+	return q.forRef(v, ref)
+}
+
+// Return a new Query filtered by the reference ref on v's Relation
+func (q *Query) forRef(v RecordValue, ref *ref) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	switch ref.kind {
+	// select * from x where (id) = (v.fk)
+	case r_hasOne:
+		vals, err := keyVals(v, ref.fk.names())
+		if err != nil {
+			q2.err = err
 			return q2
 		}
-		if fkv.IsNull() {
-			q2.err = fmt.Errorf("RecordValue for %s has a NULL foreign key", vrel.Name)
+		return q2.Where(keyEq(ref.fk.fcols), vals...)
+	// select * from x where (fk) = (v.id)
+	case r_hasMany:
+		vals, err := keyVals(v, ref.fk.fcols)
+		if err != nil {
+			q2.err = err
 			return q2
 		}
-		pk := q.from.pk()
-		if pk == nil {
-			q2.err = fmt.Errorf("%s must have a primary key to use in For query",
-				q.from.Name)
+		return q2.Where(keyEq(ref.fk.names()), vals...)
+	// select * from x where (id) IN (select x_id from x_v where (v_id) = (v.id))
+	case r_hasManyThrough:
+		vals, err := keyVals(v, ref.vfk.fcols)
+		if err != nil {
+			q2.err = err
 			return q2
 		}
-		return q2.Where(fmt.Sprintf(`%s = $1`, pk.name), fkv)
+		return q2.Where(fmt.Sprintf(`%s IN (SELECT %s FROM %s WHERE %s)`,
+			keyExpr(ref.fk.fcols),
+			strings.Join(ref.fk.names(), ","),
+			ref.via.Name,
+			keyEq(ref.vfk.names())), vals...)
 	}
-	// check for a ref on v that can be used (has many)
-	// select * from x where fk = v.id
-	if ref := q.refFor(r_hasMany, q.from, vrel); ref != nil {
-		pk := vrel.pk()
-		if pk == nil {
-			q2.err = fmt.Errorf("RecordValue for %s must have a primary key to use in For query",
-				vrel.Name)
-			return q2
+	q2.err = fmt.Errorf("Unknown reference kind %d for %s", ref.kind, ref.name)
+	return q2
+}
+
+// return the values of the named cols of v for use as query params.
+// errors if any are missing or NULL
+func keyVals(v RecordValue, names []string) ([]interface{}, error) {
+	vals := make([]interface{}, len(names))
+	for i, name := range names {
+		vx := v.ValueBy(name)
+		if vx == nil {
+			return nil, fmt.Errorf("%w %s for %s", ErrUnknownColumn, name, v.Relation().Name)
 		}
-		pkv := v.ValueBy(pk.name)
-		if pkv.IsNull() {
-			q2.err = fmt.Errorf("RecordValue for %s has a NULL primary key", vrel.Name)
-			return q2
+		if vx.IsNull() {
+			return nil, fmt.Errorf("RecordValue for %s has a NULL %s", v.Relation().Name, name)
 		}
-		return q2.Where(fmt.Sprintf(`%s = $1`, ref.col.name), pkv)
+		vals[i] = hide(v.Relation().col(name), vx)
 	}
-	q2.err = fmt.Errorf("No reference columns between %s and %s", q.from.Name, vrel.Name)
-	return q2
+	return vals, nil
 }
 
-// find a column
-func (q *Query) refFor(kind refkind, target *Relation, within *Relation) *ref {
-	if within.refs == nil {
-		return nil
+// return the col names as a key expression. ie "a" or "(a,b)"
+func keyExpr(names []string) string {
+	if len(names) == 1 {
+		return names[0]
 	}
+	return fmt.Sprintf(`(%s)`, strings.Join(names, ","))
+}
+
+// return an expression comparing the col names with placeholders.
+// ie "a = $1" or "(a,b) = ($1,$2)"
+func keyEq(names []string) string {
+	binds := make([]string, len(names))
+	for i := range names {
+		binds[i] = fmt.Sprintf(`$%d`, i+1)
+	}
+	return fmt.Sprintf(`%s = %s`, keyExpr(names), keyExpr(binds))
+}
+
+// find all refs of the given kinds within a relation that point to target
+func (q *Query) refsFor(target *Relation, within *Relation, kinds ...refkind) []*ref {
+	refs := make([]*ref, 0)
 	for _, ref := range within.refs {
-		if ref.rel == target && ref.kind == kind {
-			return ref
+		if ref.rel != target {
+			continue
+		}
+		for _, kind := range kinds {
+			if ref.kind == kind {
+				refs = append(refs, ref)
+			}
 		}
 	}
-	return nil
+	return refs
 }
 
 // Return a new Query with a LIMIT set
@@ -407,13 +700,290 @@ func (q *Query) Offset(n int) *Query {
 	return q2
 }
 
+// Return a new Query with an additional ORDER BY expression(s)
+// ie OrderBy("age DESC", "id DESC")
+func (q *Query) OrderBy(exprs ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.order = append(q2.order, exprs...)
+	q2.err = q2.checkDistinctOn()
+	return q2
+}
+
+// Return a new Query that only returns distinct rows (SELECT DISTINCT).
+// Aggregates (Count, Sum etc) are then performed over the distinct rows
+func (q *Query) Distinct() *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.distinct = true
+	return q2
+}
+
+// Return a new Query that only returns the first row for each
+// distinct set of values of the named cols (SELECT DISTINCT ON).
+// Any OrderBy must start with the same cols
+func (q *Query) DistinctOn(names ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	for _, name := range names {
+		if q.from.col(name) == nil {
+			q2.err = fmt.Errorf("could not use DISTINCT ON %w name: %s", ErrUnknownColumn, name)
+			return q2
+		}
+	}
+	q2.distinctOn = append(q2.distinctOn, names...)
+	q2.err = q2.checkDistinctOn()
+	return q2
+}
+
+// check that the DistinctOn cols match the leading OrderBy cols
+// as postgresql requires
+func (q *Query) checkDistinctOn() error {
+	if len(q.distinctOn) == 0 || len(q.order) == 0 {
+		return nil
+	}
+	if len(q.order) < len(q.distinctOn) {
+		return fmt.Errorf("DISTINCT ON (%s) must match the leading OrderBy expressions",
+			strings.Join(q.distinctOn, ","))
+	}
+	for i, name := range q.distinctOn {
+		parts := strings.Fields(q.order[i])
+		if parts[0] != name {
+			return fmt.Errorf("DISTINCT ON (%s) must match the leading OrderBy expressions",
+				strings.Join(q.distinctOn, ","))
+		}
+	}
+	return nil
+}
+
+// parse the OrderBy expressions into the cols and direction used for
+// keyset pagination. All expressions must be plain cols in the same direction
+func (q *Query) keyset() ([]*Column, bool, error) {
+	if len(q.order) == 0 {
+		return nil, false, fmt.Errorf("keyset pagination requires an OrderBy")
+	}
+	cols := make([]*Column, len(q.order))
+	var desc bool
+	for i, o := range q.order {
+		parts := strings.Fields(o)
+		c := q.from.col(parts[0])
+		if c == nil {
+			return nil, false, fmt.Errorf("cannot use %s for keyset pagination, %w of %s", o, ErrUnknownColumn, q.from.Name)
+		}
+		// the row comparison in seek cannot follow NULLS FIRST/LAST or COLLATE
+		if len(parts) > 2 || (len(parts) == 2 && !strings.EqualFold(parts[1], "ASC") && !strings.EqualFold(parts[1], "DESC")) {
+			return nil, false, fmt.Errorf("cannot use %s for keyset pagination, only a col with ASC or DESC", o)
+		}
+		d := len(parts) > 1 && strings.EqualFold(parts[1], "DESC")
+		if i > 0 && d != desc {
+			return nil, false, fmt.Errorf("keyset pagination requires all OrderBy cols in the same direction")
+		}
+		desc = d
+		cols[i] = c
+	}
+	return cols, desc, nil
+}
+
+// Return a new Query filtered to the rows that come after (or before) the
+// key vals in the Query's ordering. ie (a,b) > ($1,$2)
+func (q *Query) seek(vals []interface{}, before bool) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	cols, desc, err := q.keyset()
+	if err != nil {
+		q2.err = err
+		return q2
+	}
+	if len(vals) != len(cols) {
+		q2.err = fmt.Errorf("expected %d keyset values got: %d", len(cols), len(vals))
+		return q2
+	}
+	names := make([]string, len(cols))
+	binds := make([]string, len(cols))
+	vals = append([]interface{}(nil), vals...)
+	for i, c := range cols {
+		names[i] = c.name
+		vals[i] = hideArg(c, vals[i])
+		binds[i] = fmt.Sprintf("$%d", i+1)
+		if c.typ != "" {
+			binds[i] = fmt.Sprintf("cast(%s as %s)", binds[i], c.typ)
+		}
+	}
+	op := ">"
+	if desc != before {
+		op = "<"
+	}
+	q2 = q2.Where(fmt.Sprintf(`%s %s %s`, keyExpr(names), op, keyExpr(binds)), vals...)
+	q2.reverse = before
+	return q2
+}
+
+// Return a new Query for the rows after v in the Query's ordering.
+// The ordering should end with a unique col (like the primary key)
+// so that every row has a distinct position.
+// ie db.From("person").OrderBy("age", "id").After(last).Limit(10)
+func (q *Query) After(v RecordValue) *Query {
+	if q.err != nil {
+		return q
+	}
+	vals, err := q.keysetVals(v)
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.seek(vals, false)
+}
+
+// Return a new Query for the rows before v in the Query's ordering.
+// Results are still returned in the Query's ordering, so with a Limit
+// you get the page of rows immediately before v
+func (q *Query) Before(v RecordValue) *Query {
+	if q.err != nil {
+		return q
+	}
+	vals, err := q.keysetVals(v)
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.seek(vals, true)
+}
+
+// return the values of v for the keyset cols
+func (q *Query) keysetVals(v RecordValue) ([]interface{}, error) {
+	if v.Relation() != q.from {
+		return nil, fmt.Errorf("RecordValue for keyset pagination must belong to %s", q.from.Name)
+	}
+	cols, _, err := q.keyset()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	return keyVals(v, names)
+}
+
+// the data encoded within a cursor token
+type cursor struct {
+	Cols []string `json:"c"`
+	Vals []string `json:"v"`
+}
+
+// Return an opaque cursor token for the position of v in the Query's
+// ordering suitable for handing to API clients. See AfterCursor/BeforeCursor
+func (q *Query) Cursor(v RecordValue) (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	if v.Relation() != q.from {
+		return "", fmt.Errorf("RecordValue for a cursor must belong to %s", q.from.Name)
+	}
+	cols, _, err := q.keyset()
+	if err != nil {
+		return "", err
+	}
+	c := cursor{make([]string, len(cols)), make([]string, len(cols))}
+	for i, col := range cols {
+		// the token is handed to clients so must not carry secrets
+		if col.sensitive {
+			return "", fmt.Errorf("cannot use sensitive column %s in a cursor", col.name)
+		}
+		vx := v.ValueBy(col.name)
+		if vx == nil {
+			return "", fmt.Errorf("%w %s for cursor", ErrUnknownColumn, col.name)
+		}
+		if vx.IsNull() {
+			return "", fmt.Errorf("cannot use NULL %s in a cursor", col.name)
+		}
+		b, err := vx.bytes()
+		if err != nil {
+			return "", err
+		}
+		c.Cols[i] = col.name
+		c.Vals[i] = string(b)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decode a cursor token into key vals for the Query's ordering
+func (q *Query) cursorVals(token string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	var c cursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	cols, _, err := q.keyset()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Cols) != len(cols) || len(c.Vals) != len(cols) {
+		return nil, fmt.Errorf("cursor does not match the Query ordering")
+	}
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		if c.Cols[i] != col.name {
+			return nil, fmt.Errorf("cursor does not match the Query ordering")
+		}
+		vals[i] = c.Vals[i]
+	}
+	return vals, nil
+}
+
+// Return a new Query for the rows after the cursor token's position
+func (q *Query) AfterCursor(token string) *Query {
+	if q.err != nil {
+		return q
+	}
+	vals, err := q.cursorVals(token)
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.seek(vals, false)
+}
+
+// Return a new Query for the rows before the cursor token's position
+func (q *Query) BeforeCursor(token string) *Query {
+	if q.err != nil {
+		return q
+	}
+	vals, err := q.cursorVals(token)
+	if err != nil {
+		q2 := q.cp()
+		q2.err = err
+		return q2
+	}
+	return q.seek(vals, true)
+}
+
 // perform a query and return *Rows
 // ensure that deferred err is checked
 func (q *Query) rows(s string, params ...interface{}) (*Rows, error) {
 	if q.err != nil {
 		return nil, q.err
 	}
-	return q.tx.Query(s, params...)
+	return q.tx.query(OpSelect, q.from, s, params...)
 }
 
 // perform a query that returns RecordValues
@@ -423,9 +993,13 @@ func (q *Query) query(s string, params ...interface{}) ([]RecordValue, error) {
 		return nil, err
 	}
 	defer rs.Close()
+	k := q.from.k
+	if len(q.sel) > 0 {
+		k = Record(q.sel...)
+	}
 	all := make([]RecordValue, 0)
 	for rs.Next() {
-		vx, err := q.from.k(nil)
+		vx, err := k(nil)
 		if err != nil {
 			return nil, err
 		}
@@ -433,7 +1007,9 @@ func (q *Query) query(s string, params ...interface{}) ([]RecordValue, error) {
 		if !ok {
 			return nil, fmt.Errorf("%T is not a RecordValue", vx)
 		}
-		v.SetRelation(q.from)
+		if len(q.sel) == 0 {
+			v.SetRelation(q.from)
+		}
 		err = rs.ScanRecord(v)
 		if err != nil {
 			return nil, err
@@ -449,7 +1025,17 @@ func (q *Query) Fetch() ([]RecordValue, error) {
 	if q.err != nil {
 		return nil, q.err
 	}
-	return q.query(q.selectSql(), q.selectArgs()...)
+	rs, err := q.query(q.selectSql(), q.selectArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	// rows were fetched in reverse order (see Before)
+	if q.reverse {
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+	}
+	return rs, nil
 }
 
 // perform a SELECT and return a single RecordValue for this query
@@ -473,17 +1059,31 @@ func (q *Query) Get(pk interface{}) (RecordValue, error) {
 	}
 	pkcol := q.from.pk()
 	if pkcol == nil {
-		return nil, fmt.Errorf("No primary key found for relation %s", q.from.Name)
+		return nil, fmt.Errorf("%w: %s", ErrNoPrimaryKey, q.from.Name)
 	}
 	s := fmt.Sprintf(`%s = $1`, pkcol.name)
-	return q.Where(s, pk).FetchOne()
+	return q.Where(s, hideArg(pkcol, pk)).FetchOne()
+}
+
+// like Get but returns ErrNotFound if there is no such record
+func (q *Query) MustGet(pk interface{}) (RecordValue, error) {
+	v, err := q.Get(pk)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		pkcol := q.from.pk()
+		return nil, fmt.Errorf("%w: %s %s = %v", ErrNotFound, q.from.Name, pkcol.name, hideArg(pkcol, pk))
+	}
+	return v, nil
 }
 
 func (q *Query) agg(sel string, v Value, vals ...interface{}) error {
 	if q.err != nil {
 		return q.err
 	}
-	rs, err := q.rows(q.selectSql(sel), q.selectArgs()...)
+	s, args := q.aggSql(sel)
+	rs, err := q.rows(s, args...)
 	if err != nil {
 		return err
 	}
@@ -501,9 +1101,46 @@ func (q *Query) agg(sel string, v Value, vals ...interface{}) error {
 	return rs.Close()
 }
 
+// generate the SQL and args for a SELECT of the aggregate expressions
+// in names. Ordering is meaningless for an aggregate so is dropped.
+// If the Query is Distinct then the aggregates are performed over
+// the distinct rows in a subquery (aliased as the relation)
+func (q *Query) aggSql(names ...string) (string, []interface{}) {
+	if !q.distinct && len(q.distinctOn) == 0 {
+		q2 := q.cp()
+		q2.order = nil
+		return q2.selectSql(names...), q2.selectArgs()
+	}
+	// the subquery has the filters, ordering and distinct of the Query
+	// and the outer query the WITH, grouping and limits
+	sub := q.cp()
+	sub.with = nil
+	sub.group = nil
+	sub.having = nil
+	sub.havingParams = nil
+	sub.limit = 0
+	sub.offset = 0
+	with, n := q.withExpr()
+	subs, n := rebind([]string{sub.selectSql()}, n)
+	having, _ := q.havingExpr(n)
+	s := fmt.Sprintf(`%sSELECT %s FROM (%s) %s %s %s %s %s`,
+		with,
+		strings.Join(names, ","),
+		subs[0],
+		q.from.Name,
+		q.groupExpr(),
+		having,
+		q.limitExpr(),
+		q.offsetExpr())
+	return s, q.selectArgs()
+}
+
 // perform a "SELECT count(*)" query for this Query
 func (q *Query) Count() (int64, error) {
 	v, _ := BigInt(0)
+	if q.err != nil {
+		return 0, q.err
+	}
 	err := q.agg("count(*)", v)
 	if err != nil {
 		return 0, err
@@ -518,7 +1155,7 @@ func (q *Query) Sum(name string) (Value, error) {
 	}
 	for _, c := range q.from.cols {
 		if c.name == name {
-			v, err := c.k(nil)
+			v, err := sumKind(c)(nil)
 			if err != nil {
 				return nil, err
 			}
@@ -526,25 +1163,44 @@ func (q *Query) Sum(name string) (Value, error) {
 			return v, err
 		}
 	}
-	return nil, fmt.Errorf("could not use sum(%s) unknown column name: %s", name, name)
+	return nil, fmt.Errorf("could not use sum(%s) %w name: %s", name, ErrUnknownColumn, name)
+}
+
+// perform a "SELECT avg(x)" query
+func (q *Query) Avg(name string) (Value, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	for _, c := range q.from.cols {
+		if c.name == name {
+			v, err := Double(nil)
+			if err != nil {
+				return nil, err
+			}
+			err = q.agg(fmt.Sprintf("avg(%s)", name), v)
+			return v, err
+		}
+	}
+	return nil, fmt.Errorf("could not use avg(%s) %w name: %s", name, ErrUnknownColumn, name)
 }
 
-// perform a "SELECT avg(x)" query
-func (q *Query) Avg(name string) (Value, error) {
+// perform a "SELECT avg(x)" query returning the exact result
+// as a NumericValue rather than the float64 of Avg
+func (q *Query) AvgNumeric(name string) (NumericValue, error) {
 	if q.err != nil {
 		return nil, q.err
 	}
 	for _, c := range q.from.cols {
 		if c.name == name {
-			v, err := Double(nil)
+			v, err := Numeric(0, 0)(nil)
 			if err != nil {
 				return nil, err
 			}
 			err = q.agg(fmt.Sprintf("avg(%s)", name), v)
-			return v, err
+			return v.(NumericValue), err
 		}
 	}
-	return nil, fmt.Errorf("could not use avg(%s) unknown column name: %s", name, name)
+	return nil, fmt.Errorf("could not use avg(%s) %w name: %s", name, ErrUnknownColumn, name)
 }
 
 // perform a "SELECT avg(x)" query
@@ -562,7 +1218,7 @@ func (q *Query) Min(name string) (Value, error) {
 			return v, err
 		}
 	}
-	return nil, fmt.Errorf("could not use min(%s) unknown column name: %s", name, name)
+	return nil, fmt.Errorf("could not use min(%s) %w name: %s", name, ErrUnknownColumn, name)
 }
 
 // perform a "SELECT max(x)" query
@@ -580,7 +1236,7 @@ func (q *Query) Max(name string) (Value, error) {
 			return v, err
 		}
 	}
-	return nil, fmt.Errorf("could not use max(%s) unknown column name: %s", name, name)
+	return nil, fmt.Errorf("could not use max(%s) %w name: %s", name, ErrUnknownColumn, name)
 }
 
 // perform a "SELECT array_agg(x)" query. Returns an array value
@@ -598,7 +1254,236 @@ func (q *Query) ArrayAgg(name string) (Value, error) {
 			return v, err
 		}
 	}
-	return nil, fmt.Errorf("could not use array_agg(%s) unknown column name: %s", name, name)
+	return nil, fmt.Errorf("could not use array_agg(%s) %w name: %s", name, ErrUnknownColumn, name)
+}
+
+// a common table expression rendered from a Query (see DB.With)
+type cte struct {
+	name string
+	sql  string
+	args []interface{}
+	rel  *Relation // describes the rows of the cte
+}
+
+// the With type is used to build a Query that has common table
+// expressions (WITH name AS (...) SELECT ...). See DB.With
+type With struct {
+	tx   queryer
+	ctes []*cte
+	err  error // defered until a Query is performed
+}
+
+// Return a new With with an additional named common table expression
+// which may refer to the previous ones
+func (w *With) With(name string, q *Query) *With {
+	if w.err != nil {
+		return w
+	}
+	w2 := &With{w.tx, append([]*cte{}, w.ctes...), nil}
+	s, args, err := q.ToSQL()
+	if err != nil {
+		w2.err = err
+		return w2
+	}
+	w2.ctes = append(w2.ctes, &cte{name, s, args, q.relation(name)})
+	return w2
+}
+
+// Create a Query for a named common table expression or relation
+// any errors are defered until an actual query is performed
+func (w *With) From(name string) *Query {
+	q := new(Query)
+	if w.err != nil {
+		q.err = w.err
+		return q
+	}
+	q.tx = w.tx
+	q.with = w.ctes
+	for _, c := range w.ctes {
+		if c.name == name {
+			q.from = c.rel
+			return q
+		}
+	}
+	rels, err := w.tx.Relations()
+	if err != nil {
+		q.err = err
+		return q
+	}
+	rel, ok := rels[name]
+	if !ok {
+		q.err = fmt.Errorf("%w: %s", ErrNoRelation, name)
+		return q
+	}
+	q.from = rel
+	return q
+}
+
+// Group is a single result from a grouped aggregate query
+type Group struct {
+	Key   RecordValue // the values of the GROUP BY cols
+	Value Value       // the aggregate value for the group
+}
+
+// the GroupQuery type is used to perform aggregate queries
+// (Count, Sum etc) that return a result per group rather than
+// a single Value for the whole Query
+type GroupQuery struct {
+	q    *Query
+	cols []*Column
+}
+
+// Return a GroupQuery based on this query that will GROUP BY the
+// named cols. ie db.From("orders").GroupBy("status").Count()
+func (q *Query) GroupBy(names ...string) *GroupQuery {
+	g := &GroupQuery{q, nil}
+	if q.err != nil {
+		return g
+	}
+	g.q = q.cp()
+	for _, name := range names {
+		c := q.from.col(name)
+		if c == nil {
+			g.q.err = fmt.Errorf("could not GROUP BY %w name: %s", ErrUnknownColumn, name)
+			return g
+		}
+		g.cols = append(g.cols, c)
+	}
+	g.q.group = append(g.q.group, names...)
+	return g
+}
+
+// Return a new GroupQuery with an additional HAVING filter.
+// placeholders start at $1 as with Where
+func (g *GroupQuery) Having(h string, params ...interface{}) *GroupQuery {
+	if g.q.err != nil {
+		return g
+	}
+	q2 := g.q.cp()
+	q2.having = append(q2.having, h)
+	q2.havingParams = append(q2.havingParams, params...)
+	return &GroupQuery{q2, g.cols}
+}
+
+// perform the grouped aggregate query for sel and return a Group
+// for each row with the aggregate value created by k
+func (g *GroupQuery) agg(sel string, k Valstructor) ([]*Group, error) {
+	if g.q.err != nil {
+		return nil, g.q.err
+	}
+	names := make([]string, 0, len(g.q.group)+1)
+	names = append(names, g.q.group...)
+	names = append(names, sel)
+	// the Query ordering may refer to cols that are not grouped
+	// so is dropped (see aggSql)
+	s, args := g.q.aggSql(names...)
+	rs, err := g.q.rows(s, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	groups := make([]*Group, 0)
+	for rs.Next() {
+		kx, err := Record(g.cols...)([]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		key := kx.(RecordValue)
+		v, err := k(nil)
+		if err != nil {
+			return nil, err
+		}
+		dests := make([]interface{}, 0, len(names))
+		for _, vx := range key.Values() {
+			dests = append(dests, vx)
+		}
+		dests = append(dests, v)
+		err = rs.Scan(dests...)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &Group{key, v})
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	return groups, rs.Close()
+}
+
+// lookup the named col for use in an aggregate function fn
+func (g *GroupQuery) aggCol(fn string, name string) (*Column, error) {
+	if g.q.err != nil {
+		return nil, g.q.err
+	}
+	c := g.q.from.col(name)
+	if c == nil {
+		return nil, fmt.Errorf("could not use %s(%s) %w name: %s", fn, name, ErrUnknownColumn, name)
+	}
+	return c, nil
+}
+
+// perform a "SELECT count(*)" query for each group
+func (g *GroupQuery) Count() ([]*Group, error) {
+	if g.q.err != nil {
+		return nil, g.q.err
+	}
+	return g.agg("count(*)", BigInt)
+}
+
+// perform a "SELECT sum(x)" query for each group
+func (g *GroupQuery) Sum(name string) ([]*Group, error) {
+	c, err := g.aggCol("sum", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("sum(%s)", name), sumKind(c))
+}
+
+// perform a "SELECT avg(x)" query for each group
+func (g *GroupQuery) Avg(name string) ([]*Group, error) {
+	_, err := g.aggCol("avg", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("avg(%s)", name), Double)
+}
+
+// perform a "SELECT avg(x)" query for each group with the exact
+// result as a NumericValue rather than the float64 of Avg
+func (g *GroupQuery) AvgNumeric(name string) ([]*Group, error) {
+	_, err := g.aggCol("avg", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("avg(%s)", name), Numeric(0, 0))
+}
+
+// perform a "SELECT min(x)" query for each group
+func (g *GroupQuery) Min(name string) ([]*Group, error) {
+	c, err := g.aggCol("min", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("min(%s)", name), c.k)
+}
+
+// perform a "SELECT max(x)" query for each group
+func (g *GroupQuery) Max(name string) ([]*Group, error) {
+	c, err := g.aggCol("max", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("max(%s)", name), c.k)
+}
+
+// perform a "SELECT array_agg(x)" query for each group
+func (g *GroupQuery) ArrayAgg(name string) ([]*Group, error) {
+	c, err := g.aggCol("array_agg", name)
+	if err != nil {
+		return nil, err
+	}
+	return g.agg(fmt.Sprintf("array_agg(%s)", name), Array(c.k))
 }
 
 // generate SQL string for a SELECT
@@ -606,56 +1491,168 @@ func (q *Query) ArrayAgg(name string) (Value, error) {
 // override the SELECT args
 func (q *Query) selectSql(names ...string) string {
 	cols := strings.Join(names, ",")
+	if cols == "" && len(q.sel) > 0 {
+		cols = strings.Join(q.selNames(), ",")
+	}
 	if cols == "" {
 		cols = q.from.fields(true)
 	}
-	return fmt.Sprintf(`SELECT %s FROM %s %s %s %s`,
+	// placeholders follow on from each other in the same order as selectArgs
+	with, n := q.withExpr()
+	where, n := q.whereExpr(n)
+	having, _ := q.havingExpr(n)
+	return fmt.Sprintf(`%sSELECT %s%s FROM %s %s %s %s %s %s %s`,
+		with,
+		q.distinctExpr(),
 		cols,
 		q.from.Name,
-		q.whereExpr(),
+		where,
+		q.groupExpr(),
+		having,
+		q.orderExpr(),
 		q.limitExpr(),
 		q.offsetExpr())
 }
 
+// Return the SELECT statement for the Query with placeholders starting
+// at $1 along with the args to bind to them, without running it.
+// Useful for logging, testing or EXPLAIN.
+// When embedded within an expression of another Query (see WhereIn)
+// the placeholders get shifted along to follow on from the outer params
+func (q *Query) ToSQL() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	return q.selectSql(), q.selectArgs(), nil
+}
+
 // regexp to match the $X placeholders in queries
-var placePat = regexp.MustCompile(`(?:[^\\]\$)(\d+)`)
+var placePat = regexp.MustCompile(`(?:^|[^\\])\$(\d+)`)
+
+// since we restart the $X count for the params each time we call
+// Where (or Having etc) we have to rejig the $1 statements so that they line up.
+// Each expression in sts has its placeholders shifted along by the largest
+// placeholder of the expressions before it (starting from offset).
+// Returns the updated expressions and the largest placeholder used.
+func rebind(sts []string, offset int64) ([]string, int64) {
+	out := make([]string, len(sts))
+	for idx, st := range sts {
+		var max int64
+		out[idx] = placePat.ReplaceAllStringFunc(st, func(m string) string {
+			i := strings.LastIndex(m, "$")
+			n, err := strconv.ParseInt(m[i+1:], 10, 64)
+			if err != nil {
+				panic(fmt.Sprintf("could not convert %s to int", m[i+1:]))
+			}
+			if n > max {
+				max = n
+			}
+			return fmt.Sprintf(`%s%d`, m[:i+1], n+offset)
+		})
+		offset += max
+	}
+	return out, offset
+}
+
+// DISTINCT or DISTINCT ON clause (if any)
+func (q *Query) distinctExpr() string {
+	switch {
+	case len(q.distinctOn) > 0:
+		return fmt.Sprintf(`DISTINCT ON (%s) `, strings.Join(q.distinctOn, ","))
+	case q.distinct:
+		return `DISTINCT `
+	}
+	return ""
+}
+
+// WITH clause for any common table expressions (see DB.With)
+// and the largest placeholder used
+func (q *Query) withExpr() (string, int64) {
+	if len(q.with) == 0 {
+		return "", 0
+	}
+	sqls := make([]string, len(q.with))
+	for i, c := range q.with {
+		sqls[i] = c.sql
+	}
+	sts, n := rebind(sqls, 0)
+	for i, c := range q.with {
+		sts[i] = fmt.Sprintf(`%s AS (%s)`, c.name, sts[i])
+	}
+	return fmt.Sprintf(`WITH %s `, strings.Join(sts, ", ")), n
+}
 
-// convert all the where expressions into a single one
-func (q *Query) whereExpr() string {
+// convert all the where expressions into a single one with
+// placeholders following on from offset and the largest placeholder used
+func (q *Query) whereExpr(offset int64) (string, int64) {
 	if len(q.where) == 0 {
+		return "", offset
+	}
+	sts, n := rebind(q.where, offset)
+	return fmt.Sprintf(`WHERE %s`, strings.Join(sts, " AND ")), n
+}
+
+// GROUP BY clause for the grouping cols (if any)
+func (q *Query) groupExpr() string {
+	if len(q.group) == 0 {
 		return ""
 	}
-	// since we restart the $X count for the params each time we call
-	// Where we now have to rejig the $1 statements so that they line up correctly
-	sts := make([]string, len(q.where))
-	var i int64
-	for idx, st := range q.where {
-		if i == 0 { // find the bigest $X in this string
-			matches := placePat.FindAllStringSubmatch(st, -1)
-			if len(matches) == 0 {
-				continue
-			}
-			for _, m := range matches {
-				n, err := strconv.ParseInt(m[1], 10, 64)
-				if err != nil {
-					panic(fmt.Sprintf("could not convert %s to int", m[1]))
-				}
-				if n > i {
-					i = n
-				}
-			}
-		} else { // update each $X we find by adding i to it
-			st = placePat.ReplaceAllStringFunc(st, func(m string) string {
-				n, err := strconv.ParseInt(m[2:], 10, 64)
-				if err != nil {
-					panic(fmt.Sprintf("could not convert %s to int", m[2:]))
-				}
-				return fmt.Sprintf(`%s%d`, m[0:2], n+1)
-			})
+	return fmt.Sprintf(`GROUP BY %s`, strings.Join(q.group, ","))
+}
+
+// convert all the having expressions into a single one with
+// placeholders following on from offset and the largest placeholder used
+func (q *Query) havingExpr(offset int64) (string, int64) {
+	if len(q.having) == 0 {
+		return "", offset
+	}
+	sts, n := rebind(q.having, offset)
+	return fmt.Sprintf(`HAVING %s`, strings.Join(sts, " AND ")), n
+}
+
+// ORDER BY clause for the OrderBy expressions (if any).
+// if reverse is set each direction is flipped (see Before)
+func (q *Query) orderExpr() string {
+	if len(q.order) == 0 {
+		return ""
+	}
+	exprs := q.order
+	if q.reverse {
+		exprs = make([]string, len(q.order))
+		for i, o := range q.order {
+			exprs[i] = reverseOrder(o)
 		}
-		sts[idx] = st
 	}
-	return fmt.Sprintf(`WHERE %s`, strings.Join(sts, " AND "))
+	return fmt.Sprintf(`ORDER BY %s`, strings.Join(exprs, ","))
+}
+
+// flip the direction and NULLS placement of an OrderBy expression
+// keeping the rest of it (ie. COLLATE) as is
+func reverseOrder(o string) string {
+	parts := strings.Fields(o)
+	nullsFirst, nulls := false, false
+	if n := len(parts); n > 2 && strings.EqualFold(parts[n-2], "NULLS") {
+		nulls = true
+		nullsFirst = strings.EqualFold(parts[n-1], "FIRST")
+		parts = parts[:n-2]
+	}
+	desc := false
+	if n := len(parts); n > 1 && (strings.EqualFold(parts[n-1], "ASC") || strings.EqualFold(parts[n-1], "DESC")) {
+		desc = strings.EqualFold(parts[n-1], "DESC")
+		parts = parts[:n-1]
+	}
+	// postgres puts NULLs last when ascending and first when descending
+	if !nulls {
+		nullsFirst = desc
+	}
+	dir, place := "DESC", "FIRST"
+	if desc {
+		dir = "ASC"
+	}
+	if nullsFirst {
+		place = "LAST"
+	}
+	return fmt.Sprintf(`%s %s NULLS %s`, strings.Join(parts, " "), dir, place)
 }
 
 func (q *Query) limitExpr() string {
@@ -675,7 +1672,11 @@ func (q *Query) offsetExpr() string {
 // return the vals to bind to placholders for selectSql
 func (q *Query) selectArgs() []interface{} {
 	vals := make([]interface{}, 0)
+	for _, c := range q.with {
+		vals = append(vals, c.args...)
+	}
 	vals = append(vals, q.whereParams...)
+	vals = append(vals, q.havingParams...)
 	return vals
 }
 
@@ -706,9 +1707,15 @@ func (tx *Tx) From(name string) *Query {
 	return q
 }
 
-// perform query q and update values in v from the first RETURNING result
-func (tx *Tx) queryAndUpdate(q string, v RecordValue, update bool) error {
-	rs, err := tx.Query(q, v.Relation().valArgs(v, update)...)
+// Create a With for building a Query that uses q as the named
+// common table expression. See DB.With
+func (tx *Tx) With(name string, q *Query) *With {
+	return (&With{tx: tx}).With(name, q)
+}
+
+// perform query q with args and update values in v from the first RETURNING result.
+func (tx *Tx) queryAndUpdate(op Op, q string, args []interface{}, v RecordValue) error {
+	rs, err := tx.query(op, v.Relation(), q, args...)
 	if err != nil {
 		return err
 	}
@@ -719,23 +1726,25 @@ func (tx *Tx) queryAndUpdate(q string, v RecordValue, update bool) error {
 			return err
 		}
 	}
+	err = rs.Err()
+	if err != nil {
+		return tx.db.constraintErr(err)
+	}
 	return rs.Close()
 }
 
 // INSERT RecordValue(s)
 func (tx *Tx) Insert(vs ...RecordValue) error {
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return fmt.Errorf("RecordValue does not have a relation set")
-		}
-		bnds, _ := rel.bindings(false, false)
-		s := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) RETURNING %s`,
-			rel.Name,
-			rel.fields(false),
-			bnds,
-			rel.fields(true))
-		err := tx.queryAndUpdate(s, v, false)
+		err := tx.db.generateID(v)
+		if err != nil {
+			return err
+		}
+		s, args, err := InsertSQL(v)
+		if err != nil {
+			return err
+		}
+		err = tx.queryAndUpdate(OpInsert, s, args, v)
 		if err != nil {
 			return err
 		}
@@ -746,22 +1755,11 @@ func (tx *Tx) Insert(vs ...RecordValue) error {
 // UPDATE RecordValue(s)
 func (tx *Tx) Update(vs ...RecordValue) error {
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return fmt.Errorf("RecordValue does not have a relation set")
-		}
-		pk := rel.pk()
-		if pk == nil {
-			return fmt.Errorf("Relation must have a primary key to use Update")
-		}
-		bnds, n := rel.bindings(false, true)
-		s := fmt.Sprintf(`UPDATE %s SET %s WHERE %s = $%d RETURNING %s`,
-			rel.Name,
-			bnds,
-			pk.name,
-			n+1,
-			rel.fields(true))
-		err := tx.queryAndUpdate(s, v, true)
+		s, args, err := UpdateSQL(v)
+		if err != nil {
+			return err
+		}
+		err = tx.queryAndUpdate(OpUpdate, s, args, v)
 		if err != nil {
 			return err
 		}
@@ -772,16 +1770,11 @@ func (tx *Tx) Update(vs ...RecordValue) error {
 // UPDATE or INSERT RecordValue(s)
 func (tx *Tx) Upsert(vs ...RecordValue) (err error) {
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return fmt.Errorf("RecordValue does not have a relation set")
-		}
-		pk := rel.pk()
-		if pk == nil {
-			return fmt.Errorf("Relation has no primary key")
+		insert, err := isNew(v)
+		if err != nil {
+			return err
 		}
-		pkv := v.ValueBy(pk.name)
-		if pkv == nil || pkv.IsNull() {
+		if insert {
 			err = tx.Insert(v)
 		} else {
 			err = tx.Update(v)
@@ -796,22 +1789,11 @@ func (tx *Tx) Upsert(vs ...RecordValue) (err error) {
 // DELETE RecordValue(s)
 func (tx *Tx) Delete(vs ...RecordValue) error {
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return fmt.Errorf("RecordValue does not have a relation set")
-		}
-		pk := rel.pk()
-		if pk == nil {
-			return fmt.Errorf("Relation has no primary key")
-		}
-		pkv := v.ValueBy(pk.name)
-		if pkv == nil {
-			return fmt.Errorf("Value must have a primary key set")
+		s, args, err := DeleteSQL(v)
+		if err != nil {
+			return err
 		}
-		s := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`,
-			rel.Name,
-			pk.name)
-		rs, err := tx.Tx.Query(s, pkv)
+		rs, err := tx.query(OpDelete, v.Relation(), s, args...)
 		if err != nil {
 			return err
 		}
@@ -820,14 +1802,110 @@ func (tx *Tx) Delete(vs ...RecordValue) error {
 	return nil
 }
 
+// Return the INSERT statement and args that Insert would perform
+// for v without running it. Useful for logging, testing or EXPLAIN
+func InsertSQL(v RecordValue) (string, []interface{}, error) {
+	rel := v.Relation()
+	if rel == nil {
+		return "", nil, fmt.Errorf("RecordValue does not have a relation set")
+	}
+	// the pk is only sent when it is set and there is no DEFAULT for it
+	withPK := false
+	if pk := rel.pk(); pk != nil && !pk.hasDef {
+		pkv := v.ValueBy(pk.name)
+		withPK = pkv != nil && !pkv.IsNull()
+	}
+	bnds, _ := rel.bindings(withPK, false)
+	s := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) RETURNING %s`,
+		rel.Name,
+		rel.fields(withPK),
+		bnds,
+		rel.fields(true))
+	return s, rel.valArgs(v, withPK, false), nil
+}
+
+// Return the UPDATE statement and args that Update would perform
+// for v without running it
+func UpdateSQL(v RecordValue) (string, []interface{}, error) {
+	rel := v.Relation()
+	if rel == nil {
+		return "", nil, fmt.Errorf("RecordValue does not have a relation set")
+	}
+	pk := rel.pk()
+	if pk == nil {
+		return "", nil, fmt.Errorf("%w: %s cannot use Update", ErrNoPrimaryKey, rel.Name)
+	}
+	bnds, n := rel.bindings(false, true)
+	s := fmt.Sprintf(`UPDATE %s SET %s WHERE %s = $%d RETURNING %s`,
+		rel.Name,
+		bnds,
+		pk.name,
+		n+1,
+		rel.fields(true))
+	return s, rel.valArgs(v, false, true), nil
+}
+
+// Return the INSERT or UPDATE statement and args that Upsert would
+// perform for v without running it. An INSERT if v has a NULL primary
+// key otherwise an UPDATE
+func UpsertSQL(v RecordValue) (string, []interface{}, error) {
+	insert, err := isNew(v)
+	if err != nil {
+		return "", nil, err
+	}
+	if insert {
+		return InsertSQL(v)
+	}
+	return UpdateSQL(v)
+}
+
+// reports whether Upsert should INSERT v (it has a NULL primary key)
+func isNew(v RecordValue) (bool, error) {
+	rel := v.Relation()
+	if rel == nil {
+		return false, fmt.Errorf("RecordValue does not have a relation set")
+	}
+	pk := rel.pk()
+	if pk == nil {
+		return false, fmt.Errorf("%w: %s", ErrNoPrimaryKey, rel.Name)
+	}
+	pkv := v.ValueBy(pk.name)
+	return pkv == nil || pkv.IsNull(), nil
+}
+
+// Return the DELETE statement and args that Delete would perform
+// for v without running it
+func DeleteSQL(v RecordValue) (string, []interface{}, error) {
+	rel := v.Relation()
+	if rel == nil {
+		return "", nil, fmt.Errorf("RecordValue does not have a relation set")
+	}
+	pk := rel.pk()
+	if pk == nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrNoPrimaryKey, rel.Name)
+	}
+	pkv := v.ValueBy(pk.name)
+	if pkv == nil {
+		return "", nil, fmt.Errorf("Value must have a primary key set")
+	}
+	s := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`,
+		rel.Name,
+		pk.name)
+	return s, []interface{}{pkv}, nil
+}
+
 // like sql.Tx.Query only returns a *Rows rather than *sql.Rows
 func (tx *Tx) Query(q string, vals ...interface{}) (*Rows, error) {
-	rows, err := tx.Tx.Query(q, vals...)
+	return tx.query(OpRaw, nil, q, vals...)
+}
+
+// perform query q calling any hooks registered on the DB.
+// Constraint violations are returned as *ConstraintError
+func (tx *Tx) query(op Op, rel *Relation, q string, vals ...interface{}) (*Rows, error) {
+	rs, err := hookedQuery(tx.db.hooks, op, rel, tx.Tx.Query, q, vals...)
 	if err != nil {
-		return nil, err
+		return nil, tx.db.constraintErr(err)
 	}
-	rs := new(Rows)
-	rs.Rows = rows
 	return rs, nil
 }
 
@@ -840,8 +1918,22 @@ type DB struct {
 	rels      map[string]*Relation
 	getRels   *sql.Stmt
 	getCols   *sql.Stmt
+	getFKeys  *sql.Stmt
+	getCons   *sql.Stmt
+	getIdxs   *sql.Stmt
 	getType   *sql.Stmt
+	getDomCks *sql.Stmt
 	getLabels *sql.Stmt
+	hooks     []Hook
+	domains   map[uint32]*domain  // domain info by pg_type oid
+	types     map[string]TypeFunc // types registered with DB.RegisterType
+	oids      map[uint32]TypeFunc // resolved registered types by pg_type oid
+	uuidGen   func() ([16]byte, error)
+	// Valstructor for base types that are not implemented
+	typeFallback func(name string, oid uint32) (Valstructor, error)
+	// name pattern and rel.col set of sensitive cols
+	sensitivePat *regexp.Regexp
+	sensitive    map[string]bool
 }
 
 // Analog of sql.Open that returns a *DB
@@ -858,6 +1950,10 @@ func Open(connstr string) (*DB, error) {
 func newDB(rawdb *sql.DB) (db *DB, err error) {
 	db = new(DB)
 	db.DB = rawdb
+	db.domains = make(map[uint32]*domain)
+	db.types = make(map[string]TypeFunc)
+	db.oids = make(map[uint32]TypeFunc)
+	db.typeFallback = OpaqueFallback
 	db.getRels, err = db.DB.Prepare(selectRelsSql)
 	if err != nil {
 		return
@@ -866,10 +1962,26 @@ func newDB(rawdb *sql.DB) (db *DB, err error) {
 	if err != nil {
 		return
 	}
+	db.getFKeys, err = db.DB.Prepare(selectFKeysSql)
+	if err != nil {
+		return
+	}
+	db.getCons, err = db.DB.Prepare(selectConsSql)
+	if err != nil {
+		return
+	}
+	db.getIdxs, err = db.DB.Prepare(selectIndexesSql)
+	if err != nil {
+		return
+	}
 	db.getType, err = db.DB.Prepare(selectTypeSql)
 	if err != nil {
 		return
 	}
+	db.getDomCks, err = db.DB.Prepare(selectDomainChecksSql)
+	if err != nil {
+		return
+	}
 	db.getLabels, err = db.DB.Prepare(selectEnumSql)
 	if err != nil {
 		return
@@ -913,6 +2025,15 @@ func (db *DB) From(name string) *Query {
 	return q
 }
 
+// Create a With for building a Query that uses q as the named
+// common table expression. ie
+//
+//	recent := db.From("orders").Where("created > now() - interval '1 day'")
+//	rs, err := db.With("recent", recent).From("recent").Fetch()
+func (db *DB) With(name string, q *Query) *With {
+	return (&With{tx: db}).With(name, q)
+}
+
 // Get Relation info by name
 func (db *DB) Relation(name string) (*Relation, error) {
 	// TODO: stop loading ALL relations just to get one
@@ -922,19 +2043,23 @@ func (db *DB) Relation(name string) (*Relation, error) {
 	}
 	rel, ok := rels[name]
 	if !ok {
-		return nil, fmt.Errorf("No relation found: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrNoRelation, name)
 	}
 	return rel, nil
 }
 
 // like sql.DB.Query only returns a *Rows rather than sql.Rows
 func (db *DB) Query(q string, vals ...interface{}) (*Rows, error) {
-	rows, err := db.DB.Query(q, vals...)
+	return db.query(OpRaw, nil, q, vals...)
+}
+
+// perform query q calling any registered hooks.
+// Constraint violations are returned as *ConstraintError
+func (db *DB) query(op Op, rel *Relation, q string, vals ...interface{}) (*Rows, error) {
+	rs, err := hookedQuery(db.hooks, op, rel, db.DB.Query, q, vals...)
 	if err != nil {
-		return nil, err
+		return nil, db.constraintErr(err)
 	}
-	rs := new(Rows)
-	rs.Rows = rows
 	return rs, nil
 }
 
@@ -1036,48 +2161,104 @@ func (db *DB) relations() (map[string]*Relation, error) {
 	// now we have all the relation info we can extend it with
 	// the reference info
 	for _, rel := range rels {
-		for _, c := range rel.cols {
-			// skip if col does not reference another rel
-			if c.reft == "" {
-				continue
-			}
+		for _, fk := range rel.fkeys {
 			// get the foreign referenced rel
-			frel, ok := rels[c.reft]
+			frel, ok := rels[fk.reft]
 			if !ok {
-				return nil, fmt.Errorf("expected to find referenced relation: %s", c.reft)
+				return nil, fmt.Errorf("expected to find referenced relation: %s", fk.reft)
 			}
 			// add has_one to this rel
-			// strip _id suffix and camelize field name. branch_location_id -> BranchLocation
-			rx := regexp.MustCompile(`_(id|sku|key)$`)
-			hasOneName := rx.ReplaceAllString(c.name, "")
-			rel.refs = append(rel.refs, &ref{hasOneName, r_hasOne, frel, c})
+			// strip _id suffix from single col keys. branch_location_id -> branch_location
+			// multi col keys are named after the referenced relation
+			hasOneName := frel.Name
+			if len(fk.cols) == 1 {
+				rx := regexp.MustCompile(`_(id|sku|key)$`)
+				hasOneName = rx.ReplaceAllString(fk.cols[0].name, "")
+			}
+			rel.refs = append(rel.refs, &ref{hasOneName, r_hasOne, frel, fk, nil, nil})
 			// add has_many to the foreign rel
 			// NOTE:
 			// if there are multiple local keys pointing to the foreign model
-			// then the relation will be setup to look at ALL of the keys
 			// ie if you have a table (person) with two foreign keys (locate_a_id, locate_b_id)
-			// then the has_many side of that relationship will lookup like:
-			// SELECT * FROM locate WHERE id = locate_a_id OR id = locate_b_id
+			// then the has_many names will collide and get renamed after their
+			// constraints below (person_locate_a_id, person_locate_b_id)
 			hasManyName := rel.Name
-			frel.refs = append(frel.refs, &ref{hasManyName, r_hasMany, rel, c})
+			frel.refs = append(frel.refs, &ref{hasManyName, r_hasMany, rel, fk, nil, nil})
+		}
+	}
+	// relations with exactly two foreign keys that together make up the
+	// primary key (or a unique constraint) are treated as join tables
+	// and get a has_many_through on each side. ie post_tag (post_id, tag_id)
+	// adds a "tag" ref to post and a "post" ref to tag
+	for _, rel := range rels {
+		fks := rel.fkeys
+		if len(fks) != 2 || !rel.joinKey(fks[0], fks[1]) {
+			continue
+		}
+		a, b := rels[fks[0].reft], rels[fks[1].reft]
+		if a == b {
+			continue
+		}
+		a.refs = append(a.refs, &ref{b.Name, r_hasManyThrough, b, fks[1], rel, fks[0]})
+		b.refs = append(b.refs, &ref{a.Name, r_hasManyThrough, a, fks[0], rel, fks[1]})
+	}
+	// any ref names that collide within a relation are renamed after
+	// their foreign key constraint (without the _fkey suffix)
+	for _, rel := range rels {
+		seen := make(map[string]int)
+		for _, ref := range rel.refs {
+			seen[ref.name]++
+		}
+		for _, ref := range rel.refs {
+			if seen[ref.name] > 1 {
+				ref.name = strings.TrimSuffix(ref.fk.name, "_fkey")
+			}
 		}
 	}
 	return rels, rows.Close()
 }
 
+// reports whether the cols of the foreign keys a and b together are
+// exactly the primary key or a unique constraint of r
+func (r *Relation) joinKey(a, b *fkey) bool {
+	cols := make(map[*Column]bool)
+	for _, c := range append(append([]*Column(nil), a.cols...), b.cols...) {
+		cols[c] = true
+	}
+	same := func(key []*Column) bool {
+		if len(key) != len(cols) {
+			return false
+		}
+		for _, c := range key {
+			if !cols[c] {
+				return false
+			}
+		}
+		return true
+	}
+	for _, con := range r.cons {
+		switch con.kind {
+		case ConstraintPrimaryKey, ConstraintUnique:
+			if same(con.cols) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // return list of cols for a pg_class oid
-func (db *DB) cols(reloid uint32) ([]*col, error) {
+func (db *DB) cols(reloid uint32) ([]*Column, error) {
 	rows, err := db.getCols.Query(reloid)
 	if err != nil {
 		return nil, err
 	}
-	cols := make([]*col, 0)
+	cols := make([]*Column, 0)
 	for rows.Next() {
-		c := new(col)
+		c := new(Column)
 		var argstr string
-		var num int
-		err = rows.Scan(&num, &c.name, &c.typ, &c.oid, &c.notNull,
-			&c.pk, &c.reft, &c.reff, &argstr)
+		err = rows.Scan(&c.num, &c.name, &c.typ, &c.oid, &c.notNull,
+			&c.hasDef, &c.pk, &argstr, &c.comment, &c.def)
 		if err != nil {
 			return nil, err
 		}
@@ -1090,6 +2271,7 @@ func (db *DB) cols(reloid uint32) ([]*col, error) {
 		if err != nil {
 			return nil, err
 		}
+		c.dom = db.domains[c.oid]
 		cols = append(cols, c)
 	}
 	err = rows.Err()
@@ -1103,17 +2285,68 @@ func (db *DB) cols(reloid uint32) ([]*col, error) {
 func (db *DB) relation(name string, oid uint32) (r *Relation, err error) {
 	r = new(Relation)
 	r.Name = name
+	r.db = db
 	r.cols, err = db.cols(oid)
+	if err != nil {
+		return nil, err
+	}
+	db.markSensitive(r)
 	r.k = Record(r.cols...)
+	r.fkeys, err = db.fkeys(r, oid)
+	if err != nil {
+		return nil, err
+	}
+	r.cons, err = db.constraints(r, oid)
+	if err != nil {
+		return nil, err
+	}
+	r.idxs, err = db.indexes(oid)
 	return r, err
 }
 
+// return list of foreign keys for a pg_class oid
+func (db *DB) fkeys(r *Relation, reloid uint32) ([]*fkey, error) {
+	rows, err := db.getFKeys.Query(reloid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fks := make([]*fkey, 0)
+	for rows.Next() {
+		fk := new(fkey)
+		var names, fnames string
+		err = rows.Scan(&fk.name, &fk.reft, &names, &fnames)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(names, ",") {
+			c := r.col(name)
+			if c == nil {
+				return nil, fmt.Errorf("expected to find col %s for foreign key %s", name, fk.name)
+			}
+			fk.cols = append(fk.cols, c)
+		}
+		fk.fcols = strings.Split(fnames, ",")
+		for i, c := range fk.cols {
+			if c.fkRel == "" {
+				c.fkRel, c.fkCol = fk.reft, fk.fcols[i]
+			}
+		}
+		fks = append(fks, fk)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return fks, rows.Close()
+}
+
 // lookup a Valstructor for the pg_type of the column
-// if nothing is found in the typs map, then it will
-// try to construct an array or composite type from the
-// info in the pg_type system table
+// if the oid has not already been resolved to a registered type
+// then it will look it up by name or try to construct an array
+// or composite type from the info in the pg_type system table
 func (db *DB) kind(oid uint32, args ...string) (Valstructor, error) {
-	if f, ok := typs[oid]; ok {
+	if f, ok := db.oids[oid]; ok {
 		return f(args...)
 	}
 	return db.complexKind(oid, args...)
@@ -1131,7 +2364,7 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 	}
 	var (
 		name     string // the string representation
-		typ      string // b=base c=composite d=domain e=enum p=pseudo
+		typ      string // b=base c=composite d=domain e=enum r=range p=pseudo
 		delim    string // delimeter when array=0
 		relid    uint32 // pg_class oid when typ=c
 		elem     uint32 // the pg_type oid of the element (or 0 if not array)
@@ -1140,10 +2373,12 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 		basetype uint32 // pg_type oid of base type when typ=d
 		typmod   int32  // type-specific data supplied at table creation time
 		ndims    int32  // num of array dimension when typ=d
+		basefmt  string // format_type of the base type when typ=d
+		nsp      string // the schema of the type
 	)
 	err = rows.Scan(
 		&name, &typ, &delim, &relid, &elem, &array,
-		&notnull, &basetype, &typmod, &ndims,
+		&notnull, &basetype, &typmod, &ndims, &basefmt, &nsp,
 	)
 	if err != nil {
 		return nil, err
@@ -1156,6 +2391,11 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 	if err != nil {
 		return nil, err
 	}
+	// registered types by name
+	if f := db.typeFunc(nsp, name); f != nil {
+		db.oids[oid] = f
+		return f(args...)
+	}
 	switch typ {
 	// base types
 	case "b":
@@ -1166,26 +2406,16 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 			if err != nil {
 				return nil, err
 			}
+			if d, ok := db.domains[elem]; ok {
+				db.domains[oid] = d.arrayOf()
+			}
 			return Array(elk), nil
-		// handle other base types
+		// other (unknown) base types
 		default:
-			switch name {
-			// auto-register hstore oid
-			case "hstore":
-				typs[oid] = func(args ...string) (Valstructor, error) {
-					return HStore, nil
-				}
-				return HStore, nil
-			case "tsvector":
-				typs[oid] = func(args ...string) (Valstructor, error) {
-					return Text, nil
-				}
-				return Text, nil
-
-			// other (unknown) base types
-			default:
-				return nil, fmt.Errorf("base type %s with oid %d is not implimented", name, oid)
+			if db.typeFallback != nil {
+				return db.typeFallback(name, oid)
 			}
+			return nil, fmt.Errorf("base type %s with oid %d is not implimented", name, oid)
 		}
 	// composite types
 	case "c":
@@ -1196,7 +2426,7 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 		return Record(cols...), nil
 	// domain types
 	case "d":
-		return nil, fmt.Errorf("domain types not implimented yet")
+		return db.domainKind(oid, name, notnull, basetype, basefmt)
 	// enum types
 	case "e":
 		labels, err := db.enumLabelsFor(oid)
@@ -1207,6 +2437,12 @@ func (db *DB) complexKind(oid uint32, args ...string) (Valstructor, error) {
 			return nil, fmt.Errorf("No labels found for Enum type %s", name)
 		}
 		return Enum(labels...), nil
+	// range and multirange types are kept as text like unknown base types
+	case "r", "m":
+		if db.typeFallback != nil {
+			return db.typeFallback(name, oid)
+		}
+		return nil, fmt.Errorf("range type %s with oid %d is not implimented", name, oid)
 	// psuedo types
 	default:
 		return nil, fmt.Errorf("psuedo pg_types cannot be supported")
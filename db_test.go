@@ -1,7 +1,10 @@
 package pqutil
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 	"testing"
@@ -34,8 +37,8 @@ var testcols = [...]*tc{
 	&tc{`double precision`, 3.1459, "3.1459"},
 	&tc{`numeric(15,3)`, 0.120, "0.120"},
 	&tc{`bytea`, []byte("xyz"), "xyz"},
-	&tc{`timestamp`, "2011-01-01 23:01", "2011-01-01T23:01:00Z"},
-	&tc{`timestamptz`, "2011-01-01 23:02:00", "2011-01-01T23:02:00Z"},
+	&tc{`timestamp`, "2011-01-01 23:01", "2011-01-01 23:01:00"},
+	&tc{`timestamptz`, "2011-01-01 23:02:00", "2011-01-01 23:02:00+00"},
 	&tc{`boolean`, true, "t"},
 	&tc{`gender`, "male", "male"},
 	&tc{`hstore`,
@@ -73,10 +76,10 @@ var testcols = [...]*tc{
 		`{"\\x78","\\x79"}`},
 	&tc{`timestamp[]`,
 		[]interface{}{"2009-01-01", "2010-01-01"},
-		`{2009-01-01T00:00:00Z,2010-01-01T00:00:00Z}`},
+		`{"2009-01-01 00:00:00","2010-01-01 00:00:00"}`},
 	&tc{`timestamptz[]`,
 		[]interface{}{"2011-01-01", "2012-01-01"},
-		`{2011-01-01T00:00:00Z,2012-01-01T00:00:00Z}`},
+		`{"2011-01-01 00:00:00+00","2012-01-01 00:00:00+00"}`},
 	&tc{`boolean[]`,
 		[]interface{}{true, false},
 		`{t,f}`},
@@ -92,14 +95,31 @@ var testcols = [...]*tc{
 			[]interface{}{`"`, `\"`, `\\}`},
 			[]interface{}{"2011-01-01", "2012-01-01"},
 		},
-		`("{8,8,8}","{""\\"""",""\\\\\\"""",""\\\\\\\\}""}","{2011-01-01T00:00:00Z,2012-01-01T00:00:00Z}")`,
+		`("{8,8,8}","{""\\"""",""\\\\\\"""",""\\\\\\\\}""}","{""2011-01-01 00:00:00+00"",""2012-01-01 00:00:00+00""}")`,
 	},
+	&tc{`jsonb`, `{"a": [1, 2]}`, `{"a": [1, 2]}`},
+	&tc{`jsonb[]`,
+		[]interface{}{`{"a": 1}`, `2`},
+		`{"{\"a\": 1}","2"}`},
+	&tc{`date`, "2011-01-01", "2011-01-01"},
+	&tc{`time`, "04:05:06.5", "04:05:06.5"},
+	&tc{`timetz`, "04:05:06+05:30", "04:05:06+05:30"},
+	&tc{`date[]`,
+		[]interface{}{"2011-01-01", "infinity"},
+		`{"2011-01-01","infinity"}`},
+	&tc{`interval`, "1 year 2 mons -3 days +04:05:06.5", "1 year 2 mons -3 days +04:05:06.5"},
+	&tc{`interval[]`,
+		[]interface{}{"1 day", "00:00:01"},
+		`{"1 day","00:00:01"}`},
+	&tc{`uuid`, "{A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11}", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
 }
 
 var setup = []string{
 	// reset
 	`DROP SCHEMA public CASCADE`,
 	`CREATE SCHEMA public`,
+	`DROP SCHEMA IF EXISTS other CASCADE`,
+	`CREATE SCHEMA other`,
 	`CREATE EXTENSION hstore`,
 	// create an ENUM
 	`CREATE TYPE gender AS ENUM (
@@ -126,6 +146,109 @@ var setup = []string{
 	`INSERT INTO person VALUES (1,'bob',19, 100)`,
 	`INSERT INTO person VALUES (2,'jeff',20, 100)`,
 	`INSERT INTO person VALUES (3,'alice',17, 200)`,
+	`CREATE TABLE post (
+		id serial primary key,
+		title text
+	)`,
+	`CREATE TABLE tag (
+		id serial primary key,
+		name text
+	)`,
+	`CREATE TABLE post_tag (
+		post_id integer REFERENCES post,
+		tag_id integer REFERENCES tag,
+		added timestamp DEFAULT now(),
+		PRIMARY KEY (post_id, tag_id)
+	)`,
+	`CREATE TABLE review (
+		id serial primary key,
+		post_id integer REFERENCES post,
+		tag_id integer REFERENCES tag
+	)`,
+	`INSERT INTO post VALUES (1,'p1')`,
+	`INSERT INTO post VALUES (2,'p2')`,
+	`INSERT INTO tag VALUES (10,'go')`,
+	`INSERT INTO tag VALUES (20,'sql')`,
+	`INSERT INTO post_tag VALUES (1,10)`,
+	`INSERT INTO post_tag VALUES (1,20)`,
+	`INSERT INTO post_tag VALUES (2,20)`,
+	`CREATE TABLE trip (
+		id serial primary key,
+		from_id integer REFERENCES location,
+		to_id integer REFERENCES location
+	)`,
+	`INSERT INTO trip VALUES (1000,100,200)`,
+	`INSERT INTO trip VALUES (2000,200,200)`,
+	`CREATE TABLE shelf (
+		aisle integer,
+		bay integer,
+		label text,
+		PRIMARY KEY (aisle, bay)
+	)`,
+	`CREATE TABLE book (
+		id serial primary key,
+		title text,
+		aisle integer,
+		bay integer,
+		FOREIGN KEY (bay, aisle) REFERENCES shelf (bay, aisle)
+	)`,
+	`INSERT INTO shelf VALUES (1,1,'a')`,
+	`INSERT INTO shelf VALUES (1,2,'b')`,
+	`INSERT INTO book VALUES (1,'b1',1,2)`,
+	`INSERT INTO book VALUES (2,'b2',1,2)`,
+	`INSERT INTO book VALUES (3,'b3',1,1)`,
+	`CREATE TABLE account (
+		id serial primary key,
+		email text,
+		password_hash text,
+		pin integer
+	)`,
+	`COMMENT ON COLUMN account.pin IS 'login pin @sensitive'`,
+	`INSERT INTO account VALUES (1,'a@example.com','xyzzy',1234)`,
+	`CREATE TABLE member (
+		id serial primary key,
+		handle varchar(5) NOT NULL,
+		joined timestamp NOT NULL DEFAULT now(),
+		sex gender,
+		score numeric(4,2),
+		age integer CHECK (age >= 0 AND age < 150),
+		CHECK (length(handle) > 1),
+		CONSTRAINT member_handle_key UNIQUE (handle) DEFERRABLE INITIALLY DEFERRED
+	)`,
+	`CREATE TABLE booking (
+		id serial primary key,
+		during tsrange,
+		EXCLUDE USING gist (during WITH &&)
+	)`,
+	`CREATE INDEX member_lower_handle ON member (lower(handle), age) WHERE age > 18`,
+	`CREATE DOMAIN email AS varchar(255) CHECK (VALUE ~ '^[^@]+@[^@]+$')`,
+	`CREATE DOMAIN positive_int AS integer NOT NULL CHECK (VALUE > 0)`,
+	`CREATE DOMAIN currency_code AS char(3) CHECK (VALUE ~ '^[A-Z]{3}$')`,
+	`CREATE TABLE price (
+		id serial primary key,
+		amount positive_int,
+		currency currency_code,
+		contact email,
+		tiers positive_int[]
+	)`,
+	`INSERT INTO price VALUES (1, 100, 'GBP', 'a@example.com', '{1,2}')`,
+	`CREATE TABLE place (
+		id serial primary key,
+		at point,
+		spots point[]
+	)`,
+	`INSERT INTO place VALUES (1, '(1,2)', '{"(3,4)"}')`,
+	`CREATE TABLE device (
+		id uuid primary key,
+		name text
+	)`,
+	// a type in another schema with the same name as a built-in
+	`CREATE TYPE other.json AS ENUM ('a', 'b')`,
+	`CREATE TABLE doc (
+		id serial primary key,
+		kind other.json,
+		body json
+	)`,
 }
 
 func open(t *testing.T) *DB {
@@ -273,13 +396,15 @@ func TestRelations(t *testing.T) {
 	cnt := 0
 	for _, rel := range rels {
 		switch rel.Name {
-		case "test", "thing", "person", "location":
+		case "test", "thing", "person", "location", "post", "tag", "post_tag", "review",
+			"trip", "shelf", "book", "account", "member", "booking", "price", "place",
+			"device", "doc":
 			cnt++
 		default:
 			t.Fatal("unexpected relation %s", rel.Name)
 		}
 	}
-	if cnt != 4 {
+	if cnt != 18 {
 		t.Errorf("expected to find 2 relations got: %d", cnt)
 	}
 }
@@ -471,3 +596,1104 @@ func TestQuerySum(t *testing.T) {
 		t.Fatalf("expected sum age to be 57 got: %v", v.Val())
 	}
 }
+
+func TestRecordFrom(t *testing.T) {
+	db := open(t)
+	person, err := db.From("person").Get(3)
+	if err != nil {
+		t.Fatal(err)
+	} else if person == nil {
+		t.Fatal("no record found")
+	}
+	// has one
+	location, err := person.From("location").FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	} else if location == nil {
+		t.Fatal("expected to find location for person 3")
+	}
+	if id := location.Get("id").(int64); id != 200 {
+		t.Fatalf("expected location 200 for person 3 got: %d", id)
+	}
+	// has many
+	n, err := location.From("person").Where("age < $1", 18).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 person under 18 in location 200 got: %d", n)
+	}
+	// unknown
+	_, err = person.From("nothing").Fetch()
+	if err == nil {
+		t.Fatal("expected error for unknown reference")
+	}
+}
+
+func TestHasManyThroughReference(t *testing.T) {
+	db := open(t)
+	tag, err := db.From("tag").Get(20)
+	if err != nil {
+		t.Fatal(err)
+	} else if tag == nil {
+		t.Fatal("no record found")
+	}
+	// posts tagged via post_tag
+	n, err := db.From("post").For(tag).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 posts tagged 20 got: %d", n)
+	}
+	post, err := db.From("post").Get(2)
+	if err != nil {
+		t.Fatal(err)
+	} else if post == nil {
+		t.Fatal("no record found")
+	}
+	// tags for a post via reference navigation
+	rs, err := post.From("tag").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Get("id").(int64) != 20 {
+		t.Fatalf("expected post 2 to only be tagged 20 got: %v", rs)
+	}
+	// review has two foreign keys but they are not its key so
+	// it is not a join table between post and tag
+	if ref := post.Relation().refBy("tag"); ref == nil || ref.via.Name != "post_tag" {
+		t.Fatalf("expected the tag ref to go via post_tag got: %v", ref)
+	}
+}
+
+func TestAmbiguousReference(t *testing.T) {
+	db := open(t)
+	trip, err := db.From("trip").Get(1000)
+	if err != nil {
+		t.Fatal(err)
+	} else if trip == nil {
+		t.Fatal("no record found")
+	}
+	// two refs between trip and location
+	_, err = db.From("location").For(trip).Fetch()
+	if err == nil {
+		t.Fatal("expected For() to fail with an ambiguous reference")
+	}
+	// pick a ref by name
+	to, err := db.From("location").ForRef(trip, "to").FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	} else if to == nil {
+		t.Fatal("expected to find a location for trip 1000")
+	}
+	if id := to.Get("id").(int64); id != 200 {
+		t.Fatalf("expected trip 1000 to go to 200 got: %d", id)
+	}
+	// has many side is named after the constraints
+	location, err := db.From("location").Get(200)
+	if err != nil {
+		t.Fatal(err)
+	} else if location == nil {
+		t.Fatal("no record found")
+	}
+	n, err := db.From("trip").ForRef(location, "trip_from_id").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 trip from location 200 got: %d", n)
+	}
+	n, err = location.From("trip_to_id").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 trips to location 200 got: %d", n)
+	}
+}
+
+func TestMultiColumnReference(t *testing.T) {
+	db := open(t)
+	book, err := db.From("book").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if book == nil {
+		t.Fatal("no record found")
+	}
+	// has one over (bay, aisle)
+	shelf, err := db.From("shelf").For(book).FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	} else if shelf == nil {
+		t.Fatal("expected to find a shelf for book 1")
+	}
+	if label := shelf.Get("label").(string); label != "b" {
+		t.Fatalf(`expected book 1 to be on shelf "b" got: %s`, label)
+	}
+	// has many over (bay, aisle)
+	n, err := shelf.From("book").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 books on shelf b got: %d", n)
+	}
+}
+
+func TestGroupByCount(t *testing.T) {
+	db := open(t)
+	groups, err := db.From("person").
+		GroupBy("location_id").
+		Having("count(*) > $1", 1).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 location with more than 1 person got: %d", len(groups))
+	}
+	if id := groups[0].Key.Get("location_id").(int64); id != 100 {
+		t.Errorf("expected group for location 100 got: %d", id)
+	}
+	if n := groups[0].Value.Val().(int64); n != 2 {
+		t.Errorf("expected 2 people in location 100 got: %d", n)
+	}
+}
+
+func TestGroupBySum(t *testing.T) {
+	db := open(t)
+	groups, err := db.From("person").
+		Where("age > $1", 0).
+		GroupBy("location_id").
+		Having("sum(age) < $1", 100).
+		Sum("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 location groups got: %d", len(groups))
+	}
+	for _, g := range groups {
+		id := g.Key.Get("location_id").(int64)
+		sum := g.Value.Val().(int64)
+		switch {
+		case id == 100 && sum == 40, id == 200 && sum == 17:
+		default:
+			t.Errorf("unexpected sum(age) %d for location %d", sum, id)
+		}
+	}
+	_, err = db.From("person").GroupBy("nothing").Count()
+	if err == nil {
+		t.Error("expected error for GROUP BY unknown column")
+	}
+}
+
+func TestReverseOrder(t *testing.T) {
+	for in, out := range map[string]string{
+		"id":                         "id DESC NULLS FIRST",
+		"id ASC":                     "id DESC NULLS FIRST",
+		"id desc":                    "id ASC NULLS LAST",
+		"name NULLS FIRST":           "name DESC NULLS LAST",
+		"name DESC NULLS LAST":       "name ASC NULLS FIRST",
+		`name COLLATE "C" DESC`:      `name COLLATE "C" ASC NULLS LAST`,
+		`lower(name) ASC nulls last`: `lower(name) DESC NULLS FIRST`,
+	} {
+		if s := reverseOrder(in); s != out {
+			t.Errorf("expected %s reversed to be %s got: %s", in, out, s)
+		}
+	}
+}
+
+func TestQueryCopy(t *testing.T) {
+	base := (&Query{from: &Relation{Name: "person"}}).
+		Where("a = $1", 1).Where("b = $1", 2).Where("c = $1", 3).
+		OrderBy("a").OrderBy("b").OrderBy("c")
+	q1 := base.Where("d = $1", 4).OrderBy("d")
+	q2 := base.Where("e = $1", 5).OrderBy("e")
+	if q1.where[3] != "d = $1" || q1.whereParams[3] != 4 || q1.order[3] != "d" {
+		t.Errorf("expected q1 to be unchanged by q2 got: %v %v %v", q1.where, q1.whereParams, q1.order)
+	}
+	if q2.where[3] != "e = $1" || q2.whereParams[3] != 5 || q2.order[3] != "e" {
+		t.Errorf("expected q2 to have its own filter got: %v %v %v", q2.where, q2.whereParams, q2.order)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	sts, n := rebind([]string{"a = $1 AND b = $1", "c = 1", "$1 = d OR e = $2", "f = $1"}, 0)
+	expect := []string{"a = $1 AND b = $1", "c = 1", "$2 = d OR e = $3", "f = $4"}
+	for i, st := range sts {
+		if st != expect[i] {
+			t.Errorf("expected %q got: %q", expect[i], st)
+		}
+	}
+	if n != 4 {
+		t.Errorf("expected largest placeholder to be 4 got: %d", n)
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	db := open(t)
+	people := db.From("person").OrderBy("age DESC", "id DESC")
+	first, err := people.Limit(2).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("expected first page of 2 people got: %d", len(first))
+	}
+	// next page from the last record
+	next, err := people.After(first[1]).Limit(2).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].Get("name").(string) != "alice" {
+		t.Fatalf("expected second page to only contain alice got: %v", next)
+	}
+	// and back again via a cursor token
+	token, err := people.Cursor(next[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := people.BeforeCursor(token).Limit(2).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prev) != 2 {
+		t.Fatalf("expected previous page of 2 people got: %d", len(prev))
+	}
+	for i := range prev {
+		if prev[i].Get("id") != first[i].Get("id") {
+			t.Errorf("expected previous page to match first page at %d", i)
+		}
+	}
+	// cursors must match the ordering
+	_, err = db.From("person").OrderBy("name").AfterCursor(token).Fetch()
+	if err == nil {
+		t.Error("expected error using cursor with a different ordering")
+	}
+	// the keyset comparison cannot follow NULLS FIRST/LAST
+	_, err = db.From("person").OrderBy("age DESC NULLS LAST", "id DESC").After(first[1]).Fetch()
+	if err == nil {
+		t.Error("expected error for keyset pagination with NULLS LAST")
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	db := open(t)
+	people := db.From("person")
+	// one person per location (the oldest)
+	vs, err := people.DistinctOn("location_id").OrderBy("location_id", "age DESC").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 {
+		t.Fatalf("expected 1 person for each of 2 locations got: %d", len(vs))
+	}
+	n, err := people.DistinctOn("location_id").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected count of 2 distinct locations got: %d", n)
+	}
+	n, err = people.Distinct().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected count of 3 distinct people got: %d", n)
+	}
+	n, err = people.Select("location_id").Distinct().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected count of 2 distinct selected rows got: %d", n)
+	}
+	// aggregates are over the distinct rows not the distinct values
+	total, err := people.Sum("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := people.Distinct().Sum("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Val().(int64) != total.Val().(int64) {
+		t.Errorf("expected sum over distinct people of %v got: %v", total.Val(), sum.Val())
+	}
+	oldest, err := people.Where("location_id = $1", 100).Max("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err = people.DistinctOn("location_id").OrderBy("location_id", "age DESC").Sum("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Val().(int64) != oldest.Val().(int64)+17 {
+		t.Errorf("expected sum of the oldest in each location got: %v", sum.Val())
+	}
+	groups, err := people.DistinctOn("location_id").OrderBy("location_id", "age DESC").
+		Where("age > $1", 0).
+		GroupBy("location_id").
+		Having("count(*) > $1", 0).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 location groups got: %d", len(groups))
+	}
+	for _, g := range groups {
+		if g.Value.Val().(int64) != 1 {
+			t.Errorf("expected 1 distinct person per location got: %v", g.Value.Val())
+		}
+	}
+	// DISTINCT ON must match ORDER BY
+	_, err = people.DistinctOn("location_id").OrderBy("age").Fetch()
+	if err == nil {
+		t.Error("expected error for DISTINCT ON not matching ORDER BY")
+	}
+}
+
+func TestSubqueries(t *testing.T) {
+	db := open(t)
+	// people in locations named g1
+	g1 := db.From("location").Where("name = $1", "g1").Select("id")
+	n, err := db.From("person").
+		Where("age > $1", 0).
+		WhereIn("location_id", g1).
+		And("age < $1", 100).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 people in g1 got: %d", n)
+	}
+	// locations with people under 18
+	young := db.From("person").Where("location_id = location.id").And("age < $1", 18)
+	vs, err := db.From("location").WhereExists(young).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Get("id").(int64) != 200 {
+		t.Errorf("expected only location 200 to have young people got: %v", vs)
+	}
+}
+
+func TestWith(t *testing.T) {
+	db := open(t)
+	adults := db.From("person").Where("age >= $1", 18)
+	vs, err := db.With("adults", adults).
+		From("adults").
+		Where("name = $1", "bob").
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 {
+		t.Fatalf("expected to find bob in adults got: %d", len(vs))
+	}
+	if name := vs[0].Get("name").(string); name != "bob" {
+		t.Errorf("expected bob got: %s", name)
+	}
+	_, err = db.With("adults", adults).From("nothing").Fetch()
+	if err == nil {
+		t.Error("expected error for unknown relation")
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	db := open(t)
+	s, args, err := db.From("person").
+		Where("age > $1", 18).
+		And("name = $1", "bob").
+		OrderBy("id").
+		Limit(1).
+		ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT id,name,age,location_id FROM person WHERE age > $1 AND name = $2 ORDER BY id LIMIT 1"
+	if strings.Join(strings.Fields(s), " ") != expect {
+		t.Errorf("expected SQL to be %q got: %q", expect, s)
+	}
+	if len(args) != 2 || args[0] != 18 || args[1] != "bob" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	_, _, err = db.From("nothing").ToSQL()
+	if err == nil {
+		t.Error("expected ToSQL to return the deferred error")
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	db := open(t)
+	v, err := db.New("person", []interface{}{nil, "dave", 30, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, args, err := UpsertSQL(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, "INSERT INTO person (name,age,location_id)") {
+		t.Errorf("expected an INSERT for a NULL pk got: %s", s)
+	}
+	if len(args) != 3 {
+		t.Errorf("expected 3 args for INSERT got: %d", len(args))
+	}
+	err = v.Set("id", 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, args, err = UpsertSQL(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, "UPDATE person SET") {
+		t.Errorf("expected an UPDATE for a set pk got: %s", s)
+	}
+	s, args, err = DeleteSQL(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "DELETE FROM person WHERE id = $1" || len(args) != 1 {
+		t.Errorf("unexpected DELETE: %s %v", s, args)
+	}
+}
+
+func TestSecretScan(t *testing.T) {
+	v, _ := Int(nil)
+	err := hide(&Column{name: "pin", sensitive: true}, v).Scan("not-a-pin-9876")
+	if err == nil || strings.Contains(err.Error(), "9876") {
+		t.Fatalf("expected redacted error got: %v", err)
+	}
+	if !strings.Contains(err.Error(), Redacted) || !errors.Is(err, ErrSensitiveValue) {
+		t.Errorf("expected ErrSensitiveValue with the value redacted got: %v", err)
+	}
+	if errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("expected the underlying error to be dropped got: %v", err)
+	}
+	// a short value must not garble the message
+	err = hide(&Column{name: "pin", sensitive: true}, v).Scan("e")
+	if err == nil || err.Error() != "cannot set sensitive column pin to [REDACTED]: invalid value for sensitive column" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestHideParams(t *testing.T) {
+	r := &Relation{Name: "account", cols: []*Column{
+		{name: "id"},
+		{name: "pin", sensitive: true},
+	}}
+	args := redactArgs(hideParams(r, "pin = $1 AND id = $2", []interface{}{"1234", 1}))
+	if args[0] != Redacted || args[1] != Redacted {
+		t.Errorf("expected all params to be redacted got: %v", args)
+	}
+	args = redactArgs(hideParams(r, "pinned = $1 AND id = $2", []interface{}{"1234", 1}))
+	if args[0] != "1234" || args[1] != 1 {
+		t.Errorf("expected no params to be redacted got: %v", args)
+	}
+	a := hideArg(r.cols[1], "1234")
+	if fmt.Sprint(a) != Redacted {
+		t.Errorf("expected a redacted arg got: %v", a)
+	}
+	dv, err := a.(driver.Valuer).Value()
+	if err != nil || dv != "1234" {
+		t.Errorf("expected the real value to be bound got: %v %v", dv, err)
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	// only the commented col is sensitive by default
+	rel, err := open(t).Relation("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rel.Sensitive(), ","); got != "pin" {
+		t.Fatalf("expected only pin to be sensitive got: %s", got)
+	}
+	db, err := Open("dbname=pql_test sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetSensitivePattern(DefaultSensitivePattern)
+	rel, err = db.Relation("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rel.Sensitive(), ","); got != "password_hash,pin" {
+		t.Fatalf("expected password_hash,pin to be sensitive got: %s", got)
+	}
+	v, err := db.From("account").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := v.String()
+	if strings.Contains(s, "xyzzy") || strings.Contains(s, "1234") {
+		t.Fatalf("expected sensitive values to be redacted got: %s", s)
+	}
+	if !strings.Contains(s, Redacted) || !strings.Contains(s, "a@example.com") {
+		t.Fatalf("expected redacted record string got: %s", s)
+	}
+	// the real value is still available
+	if v.Get("password_hash") != "xyzzy" {
+		t.Fatalf("expected password_hash to be readable got: %v", v.Get("password_hash"))
+	}
+	// errors do not include the value
+	err = v.Set("pin", "not-a-pin-9876")
+	if err == nil || strings.Contains(err.Error(), "9876") {
+		t.Fatalf("expected redacted error got: %v", err)
+	}
+	if !errors.Is(err, ErrSensitiveValue) {
+		t.Errorf("expected ErrSensitiveValue got: %v", err)
+	}
+	// hook args are redacted
+	_, args, err := UpdateSQL(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range redactArgs(args) {
+		if a == "xyzzy" || fmt.Sprint(args[i]) == "xyzzy" {
+			t.Fatalf("expected arg %d to be redacted", i)
+		}
+	}
+	// including values bound by the query builder
+	h := &recordingHook{}
+	db.AddHook(h)
+	_, err = db.From("account").Where("pin = $1", "1234").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.after) != 1 || h.after[0].Args[0] != Redacted {
+		t.Fatalf("expected the pin param to be redacted got: %v", h.after)
+	}
+	_, err = db.From("account").OrderBy("pin").Cursor(v)
+	if err == nil {
+		t.Fatal("expected an error using a sensitive col in a cursor")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	db := open(t)
+	_, err := db.Relation("nope")
+	if !errors.Is(err, ErrNoRelation) {
+		t.Errorf("expected ErrNoRelation got: %v", err)
+	}
+	_, err = db.From("person").Select("nope").Fetch()
+	if !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("expected ErrUnknownColumn got: %v", err)
+	}
+	v, err := db.From("person").Get(999)
+	if v != nil || err != nil {
+		t.Errorf("expected Get to return nil for a missing record got: %v %v", v, err)
+	}
+	_, err = db.From("person").MustGet(999)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got: %v", err)
+	}
+	// foreign key violation
+	v, err = db.New("person", []interface{}{nil, "x", 30, 999})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(v)
+	var ce *ConstraintError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected ConstraintError got: %v", err)
+	}
+	if ce.Kind != ConstraintForeignKey || ce.Relation == nil || ce.Relation.Name != "person" {
+		t.Errorf("unexpected ConstraintError: %v", ce)
+	}
+	if strings.Join(ce.Cols, ",") != "location_id" {
+		t.Errorf("expected location_id col got: %v", ce.Cols)
+	}
+	var pe pq.PGError
+	if !errors.As(err, &pe) {
+		t.Errorf("expected to unwrap the driver error got: %T", errors.Unwrap(err))
+	}
+	// unique violation
+	_, err = db.Query("INSERT INTO tag VALUES ($1, $2)", 10, "dup")
+	if !errors.As(err, &ce) || ce.Kind != ConstraintUnique {
+		t.Fatalf("expected unique ConstraintError got: %v", err)
+	}
+	if strings.Join(ce.Cols, ",") != "id" {
+		t.Errorf("expected id col got: %v", ce.Cols)
+	}
+}
+
+func TestParseCheck(t *testing.T) {
+	terms := parseCheck(`CHECK (((age >= 0) AND (age < '150'::integer) AND (length(name) > 1)))`)
+	if len(terms) != 3 {
+		t.Fatalf("expected 3 terms got: %d", len(terms))
+	}
+	if terms[1].col != "age" || terms[1].op != "<" || terms[1].lit != "150" || !terms[1].num {
+		t.Errorf("unexpected term: %+v", terms[1])
+	}
+	if terms[2].col != "name" || !terms[2].length {
+		t.Errorf("expected length term got: %+v", terms[2])
+	}
+	if terms := parseCheck(`CHECK (((age > 0) OR (age IS NULL)))`); len(terms) != 0 {
+		t.Errorf("expected OR to be left for the db got: %d terms", len(terms))
+	}
+	terms = parseCheck(`CHECK (((VALUE)::text ~ '^[^@]+@[^@]+$'::text))`)
+	if len(terms) != 1 || terms[0].col != "VALUE" || terms[0].re == nil {
+		t.Fatalf("expected a regex term for VALUE got: %v", terms)
+	}
+	if v, _ := Text("a@b"); !terms[0].ok(v) {
+		t.Errorf("expected a@b to match")
+	}
+	if v, _ := Text("ab"); terms[0].ok(v) {
+		t.Errorf("expected ab not to match")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := rel.New([]interface{}{nil, "ok", nil, "male", "12.5", 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Validate(); err != nil {
+		t.Fatalf("expected valid record got: %v", err)
+	}
+	v, err = rel.New([]interface{}{nil, "toolong", nil, nil, "123.4", -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.ValueBy("sex").Scan("other")
+	err = rel.Validate(v)
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError got: %v", err)
+	}
+	for name, rule := range map[string]string{
+		"handle": "length",
+		"sex":    "enum",
+		"score":  "numeric",
+		"age":    "check",
+	} {
+		fes := ve.Field(name)
+		if len(fes) != 1 || fes[0].Rule != rule {
+			t.Errorf("expected %s error for %s got: %v", rule, name, fes)
+		}
+	}
+	// NOT NULL without a DEFAULT
+	v.Set("handle", nil)
+	err = v.Validate()
+	ve, ok = err.(*ValidationError)
+	if !ok || len(ve.Field("handle")) != 1 || ve.Field("handle")[0].Rule != "not null" {
+		t.Errorf("expected not null error for handle got: %v", err)
+	}
+	if len(ve.Field("joined")) != 0 {
+		t.Errorf("expected NULL joined to be allowed as it has a DEFAULT")
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[ConstraintKind]int)
+	for _, con := range rel.Constraints() {
+		kinds[con.Kind()]++
+	}
+	if kinds[ConstraintPrimaryKey] != 1 || kinds[ConstraintUnique] != 1 || kinds[ConstraintCheck] != 2 {
+		t.Errorf("unexpected constraint kinds: %v", kinds)
+	}
+	con := rel.Constraint("member_handle_key")
+	if con == nil {
+		t.Fatal("expected member_handle_key constraint")
+	}
+	if strings.Join(con.Cols(), ",") != "handle" || con.Def() != "UNIQUE (handle) DEFERRABLE INITIALLY DEFERRED" {
+		t.Errorf("unexpected unique constraint: %v %s", con.Cols(), con.Def())
+	}
+	if !con.Deferrable() || !con.InitiallyDeferred() {
+		t.Errorf("expected deferrable and initially deferred")
+	}
+	if n := len(rel.UniqueConstraints()); n != 2 {
+		t.Errorf("expected 2 unique constraints got: %d", n)
+	}
+	booking, err := db.Relation("booking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	con = booking.Constraint("booking_during_excl")
+	if con == nil || con.Kind() != ConstraintExclude || strings.Join(con.Cols(), ",") != "during" {
+		t.Errorf("expected exclusion constraint on during got: %v", con)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idxs := rel.Indexes()
+	if len(idxs) != 3 {
+		t.Fatalf("expected 3 indexes got: %d", len(idxs))
+	}
+	// ordered by name
+	handle, lower, pkey := idxs[0], idxs[1], idxs[2]
+	if handle.Name() != "member_handle_key" || !handle.Unique() || handle.Primary() {
+		t.Errorf("unexpected unique index: %s", handle.Def())
+	}
+	if pkey.Name() != "member_pkey" || !pkey.Primary() || pkey.Method() != "btree" {
+		t.Errorf("unexpected pk index: %s", pkey.Def())
+	}
+	if got := strings.Join(lower.Keys(), ";"); got != "lower(handle::text);age" {
+		t.Errorf("unexpected expression index keys: %s", got)
+	}
+	if lower.Predicate() != "age > 18" {
+		t.Errorf("unexpected partial index predicate: %s", lower.Predicate())
+	}
+	if !rel.Indexed("handle") || rel.Indexed("age") {
+		t.Errorf("expected handle to be indexed and age not")
+	}
+	booking, err := db.Relation("booking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range booking.Indexes() {
+		if idx.Name() == "booking_during_excl" && idx.Method() != "gist" {
+			t.Errorf("expected gist index for exclusion constraint got: %s", idx.Method())
+		}
+	}
+	// a gist index can't be used for ORDER BY
+	if booking.Indexed("during") {
+		t.Errorf("expected during to not be btree indexed")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := rel.Column("handle")
+	if c == nil {
+		t.Fatal("expected handle column")
+	}
+	if c.Name() != "handle" || c.Type() != "character varying(5)" || c.OID() != 1043 {
+		t.Errorf("unexpected handle column: %s %s %d", c.Name(), c.Type(), c.OID())
+	}
+	if c.Nullable() || c.PrimaryKey() || c.Position() != 2 {
+		t.Errorf("expected NOT NULL non pk handle at position 2")
+	}
+	if c := rel.Column("joined"); c.Default() != "now()" {
+		t.Errorf("expected now() default got: %s", c.Default())
+	}
+	if c := rel.Column("id"); !c.PrimaryKey() || c.Default() == "" {
+		t.Errorf("expected serial pk with a default")
+	}
+	v, err := rel.Column("age").Valstructor()(7)
+	if err != nil || v.String() != "7" {
+		t.Errorf("expected Valstructor to create an integer Value got: %v %v", v, err)
+	}
+	person, err := db.Relation("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frel, fcol := person.Column("location_id").References()
+	if frel != "location" || fcol != "id" {
+		t.Errorf("expected location_id to reference location.id got: %s.%s", frel, fcol)
+	}
+	account, err := db.Relation("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := account.Column("pin"); c.Comment() != "login pin @sensitive" || !c.Sensitive() {
+		t.Errorf("unexpected pin comment: %s", c.Comment())
+	}
+}
+
+func TestDomains(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := rel.Column("tiers").Domain(); d != "positive_int" {
+		t.Errorf("expected tiers to be an array of positive_int got: %s", d)
+	}
+	v, err := db.From("price").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("amount").(int64) != 100 || v.Get("currency") != "GBP" {
+		t.Errorf("unexpected price values: %s", v)
+	}
+	if err := v.Validate(); err != nil {
+		t.Errorf("expected valid price got: %v", err)
+	}
+	v, err = rel.New([]interface{}{nil, -1, "gbp", "nope", []interface{}{1, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Validate()
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError got: %v", err)
+	}
+	for _, name := range []string{"amount", "currency", "contact", "tiers"} {
+		fes := ve.Field(name)
+		if len(fes) != 1 || fes[0].Rule != "check" {
+			t.Errorf("expected check error for %s got: %v", name, fes)
+		}
+	}
+	// domain NOT NULL
+	v.Set("amount", nil)
+	ve, ok = v.Validate().(*ValidationError)
+	if !ok || len(ve.Field("amount")) != 1 || ve.Field("amount")[0].Rule != "not null" {
+		t.Errorf("expected not null error for amount got: %v", ve)
+	}
+}
+
+func TestUnknownType(t *testing.T) {
+	db := open(t)
+	v, err := db.From("place").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, ok := v.ValueBy("at").(OpaqueValue)
+	if !ok || at.TypeName() != "point" || at.String() != "(1,2)" {
+		t.Fatalf("expected opaque point value got: %v", v.ValueBy("at"))
+	}
+	// write the text back unchanged
+	v.Set("at", "(5,6)")
+	err = db.Update(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = db.From("place").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.ValueBy("at").String(); s != "(5,6)" {
+		t.Errorf("expected (5,6) got: %s", s)
+	}
+	// range types use the fallback too
+	rel, err := db.Relation("booking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	during, err := rel.Column("during").Valstructor()("[2011-01-01,2011-01-02)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ov, ok := during.(OpaqueValue); !ok || ov.TypeName() != "tsrange" {
+		t.Errorf("expected opaque tsrange value got: %T", during)
+	}
+	// without a fallback the relation cannot be loaded
+	strict, err := Open("dbname=pql_test sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strict.Close()
+	strict.SetTypeFallback(nil)
+	if _, err = strict.Relations(); err == nil {
+		t.Errorf("expected error loading point without a fallback")
+	}
+}
+
+func TestTypeFunc(t *testing.T) {
+	db := &DB{types: map[string]TypeFunc{
+		"citext": func(args ...string) (Valstructor, error) {
+			return Text, nil
+		},
+	}}
+	for _, c := range []struct {
+		nsp, name string
+		found     bool
+	}{
+		{"pg_catalog", "json", true},
+		{"other", "json", false},
+		{"public", "hstore", true},
+		{"public", "citext", true},
+		{"ext", "citext", true},
+	} {
+		if f := db.typeFunc(c.nsp, c.name); (f != nil) != c.found {
+			t.Errorf("expected %s.%s found to be %v", c.nsp, c.name, c.found)
+		}
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	open(t) // ensure the test schema exists
+	db, err := Open("dbname=pql_test sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// override a built-in and give the unknown point type a Valstructor
+	db.RegisterType("int4", func(args ...string) (Valstructor, error) {
+		return BigInt, nil
+	})
+	db.RegisterType("point", func(args ...string) (Valstructor, error) {
+		return Text, nil
+	})
+	db.RegisterType("other.json", func(args ...string) (Valstructor, error) {
+		return Text, nil
+	})
+	v, err := db.From("place").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.ValueBy("at").(OpaqueValue); ok {
+		t.Errorf("expected registered point type to be used")
+	}
+	if _, ok := v.ValueBy("spots").(IterValue); !ok {
+		t.Errorf("expected point[] to be an array of the registered type")
+	}
+	person, err := db.From("person").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := person.ValueBy("age").(*pgInteger); !ok {
+		t.Fatalf("expected age to be an integer Value got: %T", person.ValueBy("age"))
+	}
+	if bs := person.ValueBy("age").(*pgInteger).bs; bs != 64 {
+		t.Errorf("expected the registered 64bit int for int4 got: %d", bs)
+	}
+	// types are matched by schema
+	doc, err := db.Relation("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind, _ := doc.Column("kind").Valstructor()(nil)
+	if _, ok := kind.(*pgText); !ok {
+		t.Errorf("expected the registered type for other.json got: %T", kind)
+	}
+	body, _ := doc.Column("body").Valstructor()(nil)
+	if _, ok := body.(JSONValue); !ok {
+		t.Errorf("expected pg_catalog.json to use the built-in json type got: %T", body)
+	}
+	// other dbs are unaffected
+	person, err = open(t).From("person").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs := person.ValueBy("age").(*pgInteger).bs; bs != 32 {
+		t.Errorf("expected the default 32bit int for int4 got: %d", bs)
+	}
+	// and a type named like a built-in in another schema is not the built-in
+	doc, err = open(t).Relation("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind, _ = doc.Column("kind").Valstructor()(nil)
+	if _, ok := kind.(*pgEnum); !ok {
+		t.Errorf("expected other.json to be an enum got: %T", kind)
+	}
+}
+
+func TestUUIDGenerator(t *testing.T) {
+	db := open(t)
+	// without a generator the NULL pk is left to the db
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := db.New("device", []interface{}{nil, "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Insert(v); err == nil {
+		t.Errorf("expected NULL uuid pk with no DEFAULT to fail")
+	}
+	tx.Rollback()
+	db.SetUUIDGenerator(NewUUIDv7)
+	defer db.SetUUIDGenerator(nil)
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	v, err = db.New("device", []interface{}{nil, "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Insert(v); err != nil {
+		t.Fatal(err)
+	}
+	id, ok := v.ValueBy("id").(UUIDValue)
+	if !ok || id.IsNull() {
+		t.Fatalf("expected generated uuid pk got: %v", v.ValueBy("id"))
+	}
+	if id.Version() != 7 {
+		t.Errorf("expected a v7 uuid got version: %d", id.Version())
+	}
+	got, err := tx.From("device").Get(id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ValueBy("id").String() != id.String() {
+		t.Errorf("expected to Get %s got: %v", id, got)
+	}
+	// a set pk is sent as is
+	v, err = db.New("device", []interface{}{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Insert(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := v.ValueBy("id").String(); s != "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" {
+		t.Errorf("expected pk to be kept got: %s", s)
+	}
+}
+
+func TestNumericAggregates(t *testing.T) {
+	db := open(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for i, score := range []string{"60.25", "70.505"} {
+		v, err := db.New("member", []interface{}{nil, fmt.Sprintf("n%d", i), "2011-01-01", nil, score, 30})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Insert(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the sum does not fit numeric(4,2) but is still exact
+	v, err := tx.From("member").Where("handle IN ('n0','n1')").Sum("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nv, ok := v.(NumericValue)
+	if !ok || nv.Rat().Cmp(big.NewRat(13076, 100)) != 0 {
+		t.Errorf("expected exact sum of 130.76 got: %v", v)
+	}
+	nv, err = tx.From("member").Where("handle IN ('n0','n1')").AvgNumeric("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nv.Rat().Cmp(big.NewRat(6538, 100)) != 0 {
+		t.Errorf("expected exact avg of 65.38 got: %v", nv)
+	}
+	// Avg is still a float64
+	v, err = tx.From("member").Where("handle IN ('n0','n1')").Avg("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Val().(float64) != 65.38 {
+		t.Errorf("expected avg of 65.38 got: %v", v.Val())
+	}
+}
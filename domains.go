@@ -0,0 +1,112 @@
+package pqutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the constraints of a domain type that can be checked client side.
+// Values of a domain use the Valstructor of the base type
+type domain struct {
+	name    string
+	notNull bool          // domain is NOT NULL
+	checks  []*Constraint // CHECK constraints (including those of any base domain)
+	array   bool          // for a column that is an array of the domain
+}
+
+// return a copy of d for validating arrays of the domain
+func (d *domain) arrayOf() *domain {
+	d2 := *d
+	d2.array = true
+	return &d2
+}
+
+// build the Valstructor for domain type oid from its base type
+// and remember its constraints for Validate
+func (db *DB) domainKind(oid uint32, name string, notnull bool, basetype uint32, basefmt string) (Valstructor, error) {
+	k, err := db.kind(basetype, typeArgs(basefmt)...)
+	if err != nil {
+		return nil, err
+	}
+	d := &domain{name: name, notNull: notnull}
+	// domains of domains inherit the base's constraints
+	if base, ok := db.domains[basetype]; ok {
+		d.notNull = d.notNull || base.notNull
+		d.checks = append(d.checks, base.checks...)
+	}
+	rows, err := db.getDomCks.Query(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		con := &Constraint{kind: ConstraintCheck}
+		err = rows.Scan(&con.name, &con.def)
+		if err != nil {
+			return nil, err
+		}
+		con.terms = parseCheck(con.def)
+		d.checks = append(d.checks, con)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	db.domains[oid] = d
+	return k, rows.Close()
+}
+
+// return the modifiers from a formatted type name
+// ie. "character varying(255)" -> ["255"]
+func typeArgs(s string) []string {
+	i := strings.Index(s, "(")
+	j := strings.LastIndex(s, ")")
+	if i < 0 || j < i {
+		return nil
+	}
+	args := strings.Split(s[i+1:j], ",")
+	for i, a := range args {
+		args[i] = strings.TrimSpace(a)
+	}
+	return args
+}
+
+// check the (non NULL) value v of col name against the domain
+func (d *domain) validate(name string, v Value) []*FieldError {
+	if !d.array {
+		return d.validateOne(name, "", v)
+	}
+	iv, ok := v.(IterValue)
+	if !ok {
+		return nil
+	}
+	var fes []*FieldError
+	for i, el := range iv.Values() {
+		prefix := fmt.Sprintf("element %d ", i+1)
+		if el.IsNull() {
+			if d.notNull {
+				fes = append(fes, &FieldError{name, "not null", prefix + "cannot be NULL"})
+			}
+			continue
+		}
+		if msg, rule := validateValue(el); msg != "" {
+			fes = append(fes, &FieldError{name, rule, prefix + msg})
+		}
+		fes = append(fes, d.validateOne(name, prefix, el)...)
+	}
+	return fes
+}
+
+func (d *domain) validateOne(name string, prefix string, v Value) []*FieldError {
+	var fes []*FieldError
+	for _, con := range d.checks {
+		for _, t := range con.terms {
+			if t.col != "VALUE" || t.ok(v) {
+				continue
+			}
+			fes = append(fes, &FieldError{name, "check", fmt.Sprintf("%sviolates %s", prefix, con.name)})
+			break
+		}
+	}
+	return fes
+}
@@ -0,0 +1,113 @@
+package pqutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errors returned (wrapped with more detail) by pql. Test for them
+// with errors.Is
+var (
+	ErrNoRelation     = errors.New("No relation found")
+	ErrNoPrimaryKey   = errors.New("Relation has no primary key")
+	ErrNotFound       = errors.New("Record not found")
+	ErrUnknownColumn  = errors.New("unknown column")
+	ErrSensitiveValue = errors.New("invalid value for sensitive column")
+)
+
+// map of SQLSTATE codes to the kind of constraint violated
+var constraintCodes = map[string]ConstraintKind{
+	"23505": ConstraintUnique,
+	"23503": ConstraintForeignKey,
+	"23502": ConstraintNotNull,
+	"23514": ConstraintCheck,
+	"23P01": ConstraintExclude,
+}
+
+// ConstraintError is returned in place of the driver's error when
+// a query violates a constraint. Use errors.As to get at it and
+// errors.Unwrap for the original driver error
+type ConstraintError struct {
+	Kind       ConstraintKind // the kind of constraint violated
+	Code       string         // the SQLSTATE error code
+	Table      string         // name of the table the constraint is on
+	Relation   *Relation      // the Relation for Table (nil if not known)
+	Constraint string         // name of the constraint (if any)
+	Cols       []string       // the offending column(s) if they can be found
+	Err        error          // the driver error
+}
+
+func (e *ConstraintError) Error() string {
+	s := fmt.Sprintf("%s violation on %s", e.Kind, e.Table)
+	if len(e.Cols) > 0 {
+		s += fmt.Sprintf(" (%s)", strings.Join(e.Cols, ","))
+	}
+	if e.Constraint != "" {
+		s += fmt.Sprintf(" constraint %s", e.Constraint)
+	}
+	return s
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// the legacy lib/pq PGError method we use to read error fields
+// without depending on a particular driver
+type pgError interface {
+	Get(k byte) string
+}
+
+// convert driver errors for constraint violations into *ConstraintError.
+// Any other errors are returned as is
+func (db *DB) constraintErr(err error) error {
+	var pe pgError
+	if err == nil || !errors.As(err, &pe) {
+		return err
+	}
+	kind, ok := constraintCodes[pe.Get('C')]
+	if !ok {
+		return err
+	}
+	e := &ConstraintError{
+		Kind:       kind,
+		Code:       pe.Get('C'),
+		Table:      pe.Get('t'),
+		Constraint: pe.Get('n'),
+		Err:        err,
+	}
+	if db.rels != nil {
+		e.Relation = db.rels[e.Table]
+	}
+	e.Cols = constraintCols(e, pe)
+	return e
+}
+
+// find the columns involved in the violated constraint from
+// the relation's metadata or the error itself
+func constraintCols(e *ConstraintError, pe pgError) []string {
+	if c := pe.Get('c'); c != "" {
+		return []string{c}
+	}
+	if e.Relation != nil {
+		if con := e.Relation.Constraint(e.Constraint); con != nil && len(con.cols) > 0 {
+			return con.Cols()
+		}
+	}
+	// detail is like: Key (a, b)=(1, 2) already exists.
+	// only the names are used as the values may be sensitive
+	d := pe.Get('D')
+	if !strings.HasPrefix(d, "Key (") {
+		return nil
+	}
+	end := strings.Index(d, ")=")
+	if end < 0 {
+		return nil
+	}
+	cols := strings.Split(d[len("Key ("):end], ",")
+	for i, c := range cols {
+		cols[i] = strings.TrimSpace(c)
+	}
+	return cols
+}
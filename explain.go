@@ -0,0 +1,117 @@
+package pqutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// options for Query.Explain
+type ExplainOpts struct {
+	Analyze bool // actually run the query (always rolled back) to get timings
+	Buffers bool // include buffer usage (only populated with Analyze)
+}
+
+// Plan is a node in the tree returned by Query.Explain.
+// Actual* fields are only populated when ExplainOpts.Analyze is set
+// and Shared* fields only when ExplainOpts.Buffers is also set
+type Plan struct {
+	NodeType          string  `json:"Node Type"`
+	Relation          string  `json:"Relation Name"`
+	Alias             string  `json:"Alias"`
+	Index             string  `json:"Index Name"`
+	Filter            string  `json:"Filter"`
+	StartupCost       float64 `json:"Startup Cost"`
+	TotalCost         float64 `json:"Total Cost"`
+	PlanRows          float64 `json:"Plan Rows"`
+	PlanWidth         int     `json:"Plan Width"`
+	ActualStartupTime float64 `json:"Actual Startup Time"`
+	ActualTotalTime   float64 `json:"Actual Total Time"`
+	ActualRows        float64 `json:"Actual Rows"`
+	ActualLoops       float64 `json:"Actual Loops"`
+	SharedHitBlocks   int64   `json:"Shared Hit Blocks"`
+	SharedReadBlocks  int64   `json:"Shared Read Blocks"`
+	Plans             []*Plan `json:"Plans"`
+}
+
+// Explain holds the parsed output of EXPLAIN (FORMAT JSON)
+type Explain struct {
+	Plan          *Plan   `json:"Plan"`
+	PlanningTime  float64 `json:"Planning Time"`
+	ExecutionTime float64 `json:"Execution Time"`
+}
+
+// Run EXPLAIN for the Query's SELECT and return the parsed plan tree.
+// With opts.Analyze the query is executed within a transaction
+// (or a savepoint if the Query belongs to a Tx) that is always rolled back
+func (q *Query) Explain(opts ExplainOpts) (*Explain, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	args := []string{"FORMAT JSON"}
+	if opts.Analyze {
+		args = append(args, "ANALYZE")
+	}
+	if opts.Buffers {
+		args = append(args, "BUFFERS")
+	}
+	s := fmt.Sprintf(`EXPLAIN (%s) %s`, strings.Join(args, ", "), q.selectSql())
+	if !opts.Analyze {
+		return explain(q.tx, q.from, s, q.selectArgs()...)
+	}
+	switch tx := q.tx.(type) {
+	case *DB:
+		rawtx, err := tx.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer rawtx.Rollback()
+		return explain(rawtx, q.from, s, q.selectArgs()...)
+	case *Tx:
+		_, err := tx.Exec(`SAVEPOINT pql_explain`)
+		if err != nil {
+			return nil, err
+		}
+		ex, err := explain(tx, q.from, s, q.selectArgs()...)
+		if _, rerr := tx.Exec(`ROLLBACK TO SAVEPOINT pql_explain`); err == nil {
+			err = rerr
+		}
+		if _, rerr := tx.Exec(`RELEASE SAVEPOINT pql_explain`); err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ex, nil
+	}
+	return nil, fmt.Errorf("cannot EXPLAIN ANALYZE within %T", q.tx)
+}
+
+// perform the EXPLAIN query s and parse the result
+func explain(tx queryer, rel *Relation, s string, args ...interface{}) (*Explain, error) {
+	rs, err := tx.query(OpExplain, rel, s, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	var b []byte
+	for rs.Next() {
+		err = rs.Scan(&b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	var plans []*Explain
+	err = json.Unmarshal(b, &plans)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("EXPLAIN returned no plan")
+	}
+	return plans[0], rs.Close()
+}
@@ -0,0 +1,39 @@
+package pqutil
+
+import (
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	db := open(t)
+	q := db.From("person").Where("age > $1", 18)
+	plan, err := q.Explain(ExplainOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Plan == nil {
+		t.Fatal("expected a plan")
+	}
+	if plan.Plan.Relation != "person" {
+		t.Errorf("expected plan for person got: %s", plan.Plan.Relation)
+	}
+	if plan.Plan.TotalCost == 0 {
+		t.Errorf("expected plan to have a cost")
+	}
+	// analyze within a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	plan, err = tx.From("person").Where("age > $1", 18).Explain(ExplainOpts{Analyze: true, Buffers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Plan.ActualRows != 2 {
+		t.Errorf("expected 2 actual rows got: %v", plan.Plan.ActualRows)
+	}
+	if plan.ExecutionTime == 0 {
+		t.Errorf("expected ANALYZE to report an execution time")
+	}
+}
@@ -0,0 +1,100 @@
+package pqutil
+
+import (
+	"database/sql"
+	"time"
+)
+
+// the kind of operation a query is performing (see QueryEvent)
+type Op string
+
+const (
+	OpSelect  Op = "SELECT"  // Query Fetch, Count etc
+	OpInsert  Op = "INSERT"  // Insert (and Upsert)
+	OpUpdate  Op = "UPDATE"  // Update (and Upsert)
+	OpDelete  Op = "DELETE"  // Delete
+	OpExplain Op = "EXPLAIN" // Query.Explain
+	OpRaw     Op = "RAW"     // DB.Query or Tx.Query called directly
+)
+
+// QueryEvent describes a query being performed and is passed
+// to the Before and After methods of any registered Hooks
+type QueryEvent struct {
+	SQL      string        // the SQL sent to the db
+	Args     []interface{} // the args bound to the SQL placeholders (sensitive values redacted)
+	Op       Op            // the kind of operation
+	Relation *Relation     // the relation being queried (nil for OpRaw)
+	Start    time.Time     // when the query started
+	Duration time.Duration // how long the query took (After only)
+	Rows     int64         // number of rows read (After only)
+	Err      error         // any error from the query (After only)
+	// Meta can be used by hooks to pass data from Before to After
+	// (like a tracing span). It is never touched by pql
+	Meta map[string]interface{}
+}
+
+// Hook is the interface for intercepting queries for logging,
+// tracing, metrics etc. Register with DB.AddHook
+type Hook interface {
+	// called before the query is sent to the db
+	Before(e *QueryEvent)
+	// called once the query has finished. For queries that return
+	// rows this is when the Rows are closed so that Rows and Duration
+	// include reading them
+	After(e *QueryEvent)
+}
+
+// Register a Hook that will be called for every query performed by
+// the DB and any Tx started from it. Hooks are called in the order they
+// are added. AddHook is not safe to call while the DB is in use
+func (db *DB) AddHook(h Hook) {
+	db.hooks = append(db.hooks, h)
+}
+
+// perform query s with fn wrapping the result as *Rows and
+// calling Before/After on any hooks
+func hookedQuery(hooks []Hook, op Op, rel *Relation, fn func(string, ...interface{}) (*sql.Rows, error), s string, args ...interface{}) (*Rows, error) {
+	if len(hooks) == 0 {
+		rows, err := fn(s, args...)
+		if err != nil {
+			return nil, err
+		}
+		return &Rows{Rows: rows}, nil
+	}
+	e := &QueryEvent{
+		SQL:      s,
+		Args:     redactArgs(args),
+		Op:       op,
+		Relation: rel,
+		Start:    time.Now(),
+		Meta:     make(map[string]interface{}),
+	}
+	for _, h := range hooks {
+		h.Before(e)
+	}
+	rows, err := fn(s, args...)
+	if err != nil {
+		e.Err = err
+		e.Duration = time.Since(e.Start)
+		for _, h := range hooks {
+			h.After(e)
+		}
+		return nil, err
+	}
+	return &Rows{Rows: rows, event: e, hooks: hooks}, nil
+}
+
+// call After on the hooks (once) with the final state of the rows
+func (rs *Rows) after(err error) {
+	if rs.event == nil {
+		return
+	}
+	e := rs.event
+	rs.event = nil
+	e.Duration = time.Since(e.Start)
+	e.Rows = rs.n
+	e.Err = err
+	for _, h := range rs.hooks {
+		h.After(e)
+	}
+}
@@ -0,0 +1,62 @@
+package pqutil
+
+import (
+	"testing"
+)
+
+type recordingHook struct {
+	before []*QueryEvent
+	after  []*QueryEvent
+}
+
+func (h *recordingHook) Before(e *QueryEvent) {
+	e.Meta["seen"] = true
+	h.before = append(h.before, e)
+}
+
+func (h *recordingHook) After(e *QueryEvent) {
+	h.after = append(h.after, e)
+}
+
+func TestHooks(t *testing.T) {
+	open(t) // ensure the test schema exists
+	db, err := Open("dbname=pql_test sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := &recordingHook{}
+	db.AddHook(h)
+	people, err := db.From("person").Where("age > $1", 18).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.before) != 1 || len(h.after) != 1 {
+		t.Fatalf("expected 1 Before and 1 After call got: %d %d", len(h.before), len(h.after))
+	}
+	e := h.after[0]
+	if e.Op != OpSelect {
+		t.Errorf("expected op %s got: %s", OpSelect, e.Op)
+	}
+	if e.Relation == nil || e.Relation.Name != "person" {
+		t.Errorf("expected event for person relation got: %v", e.Relation)
+	}
+	if e.Rows != int64(len(people)) {
+		t.Errorf("expected %d rows got: %d", len(people), e.Rows)
+	}
+	if len(e.Args) != 1 || e.Args[0] != 18 {
+		t.Errorf("expected args [18] got: %v", e.Args)
+	}
+	if e.Meta["seen"] != true {
+		t.Errorf("expected Meta set in Before to be passed to After")
+	}
+	// errors are reported to After
+	_, err = db.Query("SELECT nope FROM person")
+	if err == nil {
+		t.Fatal("expected query error")
+	}
+	e = h.after[len(h.after)-1]
+	if e.Op != OpRaw || e.Err == nil {
+		t.Errorf("expected raw op with error got: %s %v", e.Op, e.Err)
+	}
+}
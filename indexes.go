@@ -0,0 +1,96 @@
+package pqutil
+
+// Index describes an index on a relation introspected from pg_index
+type Index struct {
+	name    string
+	method  string
+	unique  bool
+	primary bool
+	keys    []string
+	pred    string
+	def     string
+}
+
+// return the index name
+func (idx *Index) Name() string {
+	return idx.name
+}
+
+// return the access method ie. btree, hash, gin, gist, brin
+func (idx *Index) Method() string {
+	return idx.method
+}
+
+// is it a UNIQUE index
+func (idx *Index) Unique() bool {
+	return idx.unique
+}
+
+// is it the index backing the primary key
+func (idx *Index) Primary() bool {
+	return idx.primary
+}
+
+// return the key columns in order. Expression keys are
+// given as SQL (ie. "lower(name)"). INCLUDE columns are not listed
+func (idx *Index) Keys() []string {
+	return idx.keys
+}
+
+// return the WHERE predicate of a partial index or "" if none
+func (idx *Index) Predicate() string {
+	return idx.pred
+}
+
+// return the CREATE INDEX statement as given by pg_get_indexdef
+func (idx *Index) Def() string {
+	return idx.def
+}
+
+// return all the indexes on the relation ordered by name
+func (r *Relation) Indexes() []*Index {
+	return r.idxs
+}
+
+// reports whether the named col is the leading key of a btree
+// index that covers all rows (ie. not a partial index) and so
+// can be used for ORDER BY or lookups on the col
+func (r *Relation) Indexed(name string) bool {
+	for _, idx := range r.idxs {
+		if idx.method == "btree" && idx.pred == "" && len(idx.keys) > 0 && idx.keys[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// return list of indexes for a pg_class oid
+func (db *DB) indexes(reloid uint32) ([]*Index, error) {
+	rows, err := db.getIdxs.Query(reloid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	idxs := make([]*Index, 0)
+	keys, err := Array(Text)(nil)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		idx := new(Index)
+		err = rows.Scan(&idx.name, &idx.method, &idx.unique, &idx.primary,
+			keys, &idx.pred, &idx.def)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys.(IterValue).Values() {
+			idx.keys = append(idx.keys, k.String())
+		}
+		idxs = append(idxs, idx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return idxs, rows.Close()
+}
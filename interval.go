@@ -0,0 +1,294 @@
+package pqutil
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntervalValue is the Value for INTERVAL columns. Like postgres the
+// interval is held as separate months, days and microseconds as the
+// length of a month or day is not fixed
+type IntervalValue interface {
+	Value
+	Months() int32
+	Days() int32
+	Microseconds() int64
+	// return the interval as a time.Duration. Fails if there are any
+	// months or days as they cannot be converted without a date
+	Duration() (time.Duration, error)
+}
+
+// Valstructor for INTERVAL columns. Accepts postgres style
+// ("1 year 2 mons -3 days +04:05:06.5") or ISO 8601 ("P1Y2M-3DT4H5M6.5S")
+// text or a time.Duration (rounded to microseconds)
+func Interval(data interface{}) (Value, error) {
+	k := new(pgInterval)
+	return k, k.Scan(data)
+}
+
+type pgInterval struct {
+	months int32
+	days   int32
+	us     int64
+	valid  bool
+}
+
+const (
+	usPerSec  = int64(1000000)
+	usPerMin  = 60 * usPerSec
+	usPerHour = 60 * usPerMin
+	usPerDay  = 24 * usPerHour
+)
+
+func (k *pgInterval) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case time.Duration:
+		k.months, k.days = 0, 0
+		k.us = int64(math.Round(float64(x) / float64(time.Microsecond)))
+		return nil
+	case string:
+		return k.parse(x)
+	case []byte:
+		return k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set INTERVAL value with %T -> %v", src, src)
+	}
+}
+
+// interval parts as they are accumulated
+type ivParts struct {
+	months, days, us int64
+}
+
+// add n of the named unit, cascading any fraction to the smaller
+// units the way postgres does (0.5 month = 15 days, 0.5 day = 12 hours)
+func (p *ivParts) add(n float64, unit string) error {
+	switch strings.ToLower(unit) {
+	case "y", "year", "years", "yr", "yrs":
+		// like postgres a fraction of a year is rounded to months
+		return addIv(&p.months, math.Round(n*12))
+	case "mon", "mons", "month", "months":
+		whole := math.Trunc(n)
+		err := addIv(&p.months, whole)
+		if err != nil {
+			return err
+		}
+		return p.addDays((n - whole) * 30)
+	case "w", "week", "weeks":
+		return p.addDays(n * 7)
+	case "d", "day", "days":
+		return p.addDays(n)
+	case "h", "hour", "hours", "hr", "hrs":
+		return addIv(&p.us, math.Round(n*float64(usPerHour)))
+	case "min", "mins", "minute", "minutes":
+		return addIv(&p.us, math.Round(n*float64(usPerMin)))
+	case "s", "sec", "secs", "second", "seconds":
+		return addIv(&p.us, math.Round(n*float64(usPerSec)))
+	case "ms", "msec", "msecs", "millisecond", "milliseconds":
+		return addIv(&p.us, math.Round(n*1000))
+	case "us", "usec", "usecs", "microsecond", "microseconds":
+		return addIv(&p.us, math.Round(n))
+	}
+	return fmt.Errorf("unknown INTERVAL unit %s", unit)
+}
+
+// add n days with any fraction of a day cascaded to microseconds
+func (p *ivParts) addDays(n float64) error {
+	whole := math.Trunc(n)
+	err := addIv(&p.days, whole)
+	if err != nil {
+		return err
+	}
+	return addIv(&p.us, math.Round((n-whole)*float64(usPerDay)))
+}
+
+// add the whole number f to the part failing if it overflows
+func addIv(part *int64, f float64) error {
+	if f >= math.MaxInt64 || f <= math.MinInt64 {
+		return fmt.Errorf("INTERVAL out of range")
+	}
+	n := int64(f)
+	if (n > 0 && *part > math.MaxInt64-n) || (n < 0 && *part < math.MinInt64-n) {
+		return fmt.Errorf("INTERVAL out of range")
+	}
+	*part += n
+	return nil
+}
+
+var (
+	isoIntervalPat = regexp.MustCompile(`^P(?:([-+]?[\d.]+)Y)?(?:([-+]?[\d.]+)M)?(?:([-+]?[\d.]+)W)?(?:([-+]?[\d.]+)D)?(?:T(?:([-+]?[\d.]+)H)?(?:([-+]?[\d.]+)M)?(?:([-+]?[\d.]+)S)?)?$`)
+	isoUnits       = []string{"y", "mon", "w", "d", "h", "min", "s"}
+	clockPat       = regexp.MustCompile(`^([-+])?(\d+):(\d{1,2})(?::(\d{1,2}(?:\.\d+)?))?$`)
+)
+
+func (k *pgInterval) parse(s string) error {
+	s = strings.TrimSpace(s)
+	var p ivParts
+	if strings.HasPrefix(s, "P") {
+		m := isoIntervalPat.FindStringSubmatch(s)
+		if m == nil || s == "P" {
+			return fmt.Errorf("could not parse INTERVAL string %s", s)
+		}
+		for i, unit := range isoUnits {
+			if m[i+1] == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(m[i+1], 64)
+			if err != nil {
+				return fmt.Errorf("could not parse INTERVAL string %s", s)
+			}
+			err = p.add(n, unit)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		fields := strings.Fields(strings.TrimPrefix(s, "@"))
+		ago := len(fields) > 0 && fields[len(fields)-1] == "ago"
+		if ago {
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields) == 0 {
+			return fmt.Errorf("could not parse INTERVAL string %s", s)
+		}
+		for i := 0; i < len(fields); i++ {
+			if m := clockPat.FindStringSubmatch(fields[i]); m != nil {
+				h, _ := strconv.ParseFloat(m[2], 64)
+				min, _ := strconv.ParseFloat(m[3], 64)
+				sec := 0.0
+				if m[4] != "" {
+					sec, _ = strconv.ParseFloat(m[4], 64)
+				}
+				us := math.Round(h*float64(usPerHour) + min*float64(usPerMin) + sec*float64(usPerSec))
+				if m[1] == "-" {
+					us = -us
+				}
+				err := addIv(&p.us, us)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			n, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil || i+1 == len(fields) {
+				return fmt.Errorf("could not parse INTERVAL string %s", s)
+			}
+			i++
+			err = p.add(n, fields[i])
+			if err != nil {
+				return err
+			}
+		}
+		if ago {
+			p = ivParts{-p.months, -p.days, -p.us}
+		}
+	}
+	if p.months > math.MaxInt32 || p.months < math.MinInt32 || p.days > math.MaxInt32 || p.days < math.MinInt32 {
+		return fmt.Errorf("INTERVAL out of range: %s", s)
+	}
+	k.months = int32(p.months)
+	k.days = int32(p.days)
+	k.us = p.us
+	return nil
+}
+
+func (k *pgInterval) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgInterval) Months() int32 {
+	return k.months
+}
+
+func (k *pgInterval) Days() int32 {
+	return k.days
+}
+
+func (k *pgInterval) Microseconds() int64 {
+	return k.us
+}
+
+func (k *pgInterval) Duration() (time.Duration, error) {
+	if k.months != 0 || k.days != 0 {
+		return 0, fmt.Errorf("cannot convert INTERVAL %s with months or days to a Duration", k.String())
+	}
+	if k.us > math.MaxInt64/int64(time.Microsecond) || k.us < math.MinInt64/int64(time.Microsecond) {
+		return 0, fmt.Errorf("INTERVAL %s is too large for a Duration", k.String())
+	}
+	return time.Duration(k.us) * time.Microsecond, nil
+}
+
+func (k *pgInterval) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgInterval) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullb, nil
+	}
+	return []byte(k.String()), nil
+}
+
+// return the interval in postgres' default output style
+// ie. "1 year 2 mons -3 days +04:05:06.5"
+func (k *pgInterval) String() string {
+	if !k.valid {
+		return ""
+	}
+	var parts []string
+	neg := false // was the previous part negative
+	part := func(n int64, unit string) {
+		if n == 0 {
+			return
+		}
+		sign := ""
+		if neg && n > 0 {
+			sign = "+"
+		}
+		if n != 1 {
+			unit += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%s%d %s", sign, n, unit))
+		neg = n < 0
+	}
+	part(int64(k.months/12), "year")
+	part(int64(k.months%12), "mon")
+	part(int64(k.days), "day")
+	if k.us != 0 || len(parts) == 0 {
+		us := k.us
+		sign := ""
+		if us < 0 {
+			sign = "-"
+			us = -us
+		} else if neg {
+			sign = "+"
+		}
+		s := fmt.Sprintf("%s%02d:%02d:%02d", sign, us/usPerHour, us%usPerHour/usPerMin, us%usPerMin/usPerSec)
+		if frac := us % usPerSec; frac != 0 {
+			s += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// returns the postgres style text (see String)
+func (k *pgInterval) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
@@ -0,0 +1,148 @@
+package pqutil
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONValue is a Value for json and jsonb columns
+type JSONValue interface {
+	Value
+	// decode the JSON into dst as per json.Unmarshal
+	Unmarshal(dst interface{}) error
+	// return the JSON found by following path where each element is
+	// an object key (string) or array index (int). Returns nil if there
+	// is nothing at path, like the -> operator returning NULL
+	Path(path ...interface{}) (json.RawMessage, error)
+}
+
+// Valstructor for json columns.
+// Strings and []byte are taken to be JSON text, json.RawMessage is
+// used as is and any other value is encoded with json.Marshal
+func JSON(data interface{}) (Value, error) {
+	k := new(pgJSON)
+	return k, k.Scan(data)
+}
+
+// Valstructor for jsonb columns. See JSON
+func JSONB(data interface{}) (Value, error) {
+	return JSON(data)
+}
+
+type pgJSON struct {
+	b     []byte // JSON text
+	valid bool
+}
+
+func (k *pgJSON) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		k.b = nil
+		return nil
+	}
+	var b []byte
+	switch x := src.(type) {
+	case json.RawMessage:
+		b = append([]byte(nil), x...)
+	case []byte:
+		b = append([]byte(nil), x...)
+	case string:
+		b = []byte(x)
+	default:
+		var err error
+		b, err = json.Marshal(x)
+		if err != nil {
+			return fmt.Errorf("cannot set JSON Value with %T: %v", src, err)
+		}
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("cannot set JSON Value with invalid JSON text")
+	}
+	k.b = b
+	k.valid = true
+	return nil
+}
+
+func (k *pgJSON) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgJSON) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return string(k.b), nil
+}
+
+func (k *pgJSON) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullb, nil
+	}
+	return k.b, nil
+}
+
+func (k *pgJSON) String() string {
+	if !k.valid {
+		return ""
+	}
+	return string(k.b)
+}
+
+// returns the JSON text as a json.RawMessage (use Unmarshal to decode)
+func (k *pgJSON) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return json.RawMessage(k.b)
+}
+
+func (k *pgJSON) Unmarshal(dst interface{}) error {
+	if !k.valid {
+		return fmt.Errorf("cannot Unmarshal NULL JSON Value")
+	}
+	return json.Unmarshal(k.b, dst)
+}
+
+func (k *pgJSON) Path(path ...interface{}) (json.RawMessage, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	cur := json.RawMessage(k.b)
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			var obj map[string]json.RawMessage
+			if !isJSON(cur, '{') || json.Unmarshal(cur, &obj) != nil {
+				return nil, nil
+			}
+			next, ok := obj[key]
+			if !ok {
+				return nil, nil
+			}
+			cur = next
+		case int:
+			var arr []json.RawMessage
+			if !isJSON(cur, '[') || json.Unmarshal(cur, &arr) != nil {
+				return nil, nil
+			}
+			if key < 0 {
+				key += len(arr)
+			}
+			if key < 0 || key >= len(arr) {
+				return nil, nil
+			}
+			cur = arr[key]
+		default:
+			return nil, fmt.Errorf("JSON path elements must be string or int got: %T", p)
+		}
+	}
+	return cur, nil
+}
+
+// reports if the JSON text b starts with the delimiter c
+func isJSON(b []byte, c byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == c
+}
@@ -0,0 +1,330 @@
+package pqutil
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NumericValue is the Value for NUMERIC/DECIMAL columns. The number
+// is held exactly (as a big.Rat rounded to the scale of the column)
+// so it can be used for money etc without float rounding errors
+type NumericValue interface {
+	Value
+	// return a copy of the number or nil if NULL, NaN or infinite
+	Rat() *big.Rat
+	NaN() bool
+	// return 1 for Infinity, -1 for -Infinity and 0 otherwise
+	Infinity() int
+	// return the number of digits after the decimal point
+	Scale() int
+}
+
+// max digits after the decimal point for an unconstrained numeric
+// (same as postgres) and the scale used when the value is not
+// an exact decimal (ie. 1/3) also like postgres division
+const (
+	maxNumericScale = 16383
+	minDivScale     = 16
+)
+
+var numericPat = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// Valstructor for NUMERIC(prec,scale) columns. Values are rounded
+// (half away from zero) to scale and a value with more than prec-scale
+// integer digits fails validation and cannot be sent to the db.
+// A prec of 0 is an unconstrained NUMERIC which keeps the scale of
+// its input. Accepts ints, floats, *big.Int, *big.Rat, *big.Float and
+// text (including NaN, Infinity and -Infinity)
+func Numeric(prec int, scale int) Valstructor {
+	return func(data interface{}) (Value, error) {
+		k := &pgNumeric{prec: prec, scale: scale}
+		return k, k.Scan(data)
+	}
+}
+
+type pgNumeric struct {
+	r      *big.Rat
+	dscale int // display scale
+	nan    bool
+	inf    int
+	prec   int
+	scale  int
+	valid  bool
+}
+
+func (k *pgNumeric) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	// a failed Scan leaves the Value NULL rather than half set
+	k.valid, k.nan, k.inf = false, false, 0
+	switch x := src.(type) {
+	case float32:
+		err = k.setFloat(float64(x), 32)
+	case float64:
+		err = k.setFloat(x, 64)
+	case int:
+		k.setRat(new(big.Rat).SetInt64(int64(x)), 0)
+	case int8:
+		k.setRat(new(big.Rat).SetInt64(int64(x)), 0)
+	case int16:
+		k.setRat(new(big.Rat).SetInt64(int64(x)), 0)
+	case int32:
+		k.setRat(new(big.Rat).SetInt64(int64(x)), 0)
+	case int64:
+		k.setRat(new(big.Rat).SetInt64(x), 0)
+	case uint:
+		k.setRat(new(big.Rat).SetUint64(uint64(x)), 0)
+	case uint8:
+		k.setRat(new(big.Rat).SetUint64(uint64(x)), 0)
+	case uint16:
+		k.setRat(new(big.Rat).SetUint64(uint64(x)), 0)
+	case uint32:
+		k.setRat(new(big.Rat).SetUint64(uint64(x)), 0)
+	case uint64:
+		k.setRat(new(big.Rat).SetUint64(x), 0)
+	case *big.Int:
+		k.setRat(new(big.Rat).SetInt(x), 0)
+	case big.Int:
+		k.setRat(new(big.Rat).SetInt(&x), 0)
+	case *big.Rat:
+		k.setRat(new(big.Rat).Set(x), ratScale(x))
+	case big.Rat:
+		k.setRat(new(big.Rat).Set(&x), ratScale(&x))
+	case *big.Float:
+		err = k.setBigFloat(x)
+	case big.Float:
+		err = k.setBigFloat(&x)
+	case string:
+		err = k.parse(x)
+	case []byte:
+		err = k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set Numeric(%d,%d) Value with %T -> %v", k.prec, k.scale, src, src)
+	}
+	if err != nil {
+		return err
+	}
+	k.valid = true
+	return nil
+}
+
+// parse the text form of a numeric
+func (k *pgNumeric) parse(s string) error {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "nan":
+		k.nan = true
+		return nil
+	case "infinity", "+infinity", "inf", "+inf":
+		k.inf = 1
+		return nil
+	case "-infinity", "-inf":
+		k.inf = -1
+		return nil
+	}
+	m := numericPat.FindStringSubmatch(s)
+	if m == nil {
+		return fmt.Errorf("invalid input for Numeric(%d,%d): %q", k.prec, k.scale, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return fmt.Errorf("invalid input for Numeric(%d,%d): %q", k.prec, k.scale, s)
+	}
+	// the scale of the input is the digits after the point less the exponent
+	scale := 0
+	if i := strings.Index(m[1], "."); i >= 0 {
+		scale = len(m[1]) - i - 1
+	}
+	if m[2] != "" {
+		exp, err := strconv.Atoi(m[2][1:])
+		if err != nil {
+			return fmt.Errorf("invalid input for Numeric(%d,%d): %q", k.prec, k.scale, s)
+		}
+		scale -= exp
+	}
+	if scale < 0 {
+		scale = 0
+	}
+	k.setRat(r, scale)
+	return nil
+}
+
+func (k *pgNumeric) setFloat(f float64, bits int) error {
+	switch {
+	case math.IsNaN(f):
+		k.nan = true
+		return nil
+	case math.IsInf(f, 0):
+		k.inf = int(math.Copysign(1, f))
+		return nil
+	}
+	// use the shortest text that round trips to avoid binary noise
+	return k.parse(strconv.FormatFloat(f, 'f', -1, bits))
+}
+
+func (k *pgNumeric) setBigFloat(f *big.Float) error {
+	if f.IsInf() {
+		k.inf = f.Sign()
+		return nil
+	}
+	return k.parse(f.Text('f', -1))
+}
+
+// set the number rounding it to the scale of the column
+// (or scale if unconstrained)
+func (k *pgNumeric) setRat(r *big.Rat, scale int) {
+	if k.prec > 0 {
+		scale = k.scale
+	}
+	if scale > maxNumericScale {
+		scale = maxNumericScale
+	}
+	k.r = roundRat(r, scale)
+	k.dscale = scale
+}
+
+// the smallest scale that holds r exactly or minDivScale if r
+// is not a finite decimal
+func ratScale(r *big.Rat) int {
+	d := new(big.Int).Set(r.Denom())
+	scale := 0
+	for _, f := range []int64{2, 5} {
+		n := 0
+		div, mod := new(big.Int), new(big.Int)
+		for {
+			div.QuoRem(d, big.NewInt(f), mod)
+			if mod.Sign() != 0 {
+				break
+			}
+			d.Set(div)
+			n++
+		}
+		if n > scale {
+			scale = n
+		}
+	}
+	if d.Cmp(big.NewInt(1)) != 0 || scale > maxNumericScale {
+		return minDivScale
+	}
+	return scale
+}
+
+// round r to scale digits after the point, halves away from zero
+func roundRat(r *big.Rat, scale int) *big.Rat {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	n := new(big.Int).Mul(r.Num(), pow)
+	q, m := new(big.Int).QuoRem(n, r.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		// QuoRem truncates toward zero so round up |m|*2 >= denom
+		m.Abs(m).Lsh(m, 1)
+		if m.Cmp(r.Denom()) >= 0 {
+			q.Add(q, big.NewInt(int64(n.Sign())))
+		}
+	}
+	return new(big.Rat).SetFrac(q, pow)
+}
+
+// the number of digits before the decimal point
+func (k *pgNumeric) intDigits() int {
+	q := new(big.Int).Quo(k.r.Num(), k.r.Denom())
+	if q.Sign() == 0 {
+		return 0
+	}
+	return len(q.Abs(q).Text(10))
+}
+
+// check the number fits the precision of the column
+func (k *pgNumeric) overflow() bool {
+	if !k.valid || k.prec <= 0 || k.nan {
+		return false
+	}
+	return k.inf != 0 || k.intDigits() > k.prec-k.scale
+}
+
+func (k *pgNumeric) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgNumeric) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	if k.overflow() {
+		return nil, fmt.Errorf("numeric field overflow: %s does not fit NUMERIC(%d,%d)", k.String(), k.prec, k.scale)
+	}
+	return k.String(), nil
+}
+
+func (k *pgNumeric) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullb, nil
+	}
+	if k.overflow() {
+		return nil, fmt.Errorf("numeric field overflow: %s does not fit NUMERIC(%d,%d)", k.String(), k.prec, k.scale)
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgNumeric) String() string {
+	switch {
+	case !k.valid:
+		return ""
+	case k.nan:
+		return "NaN"
+	case k.inf > 0:
+		return "Infinity"
+	case k.inf < 0:
+		return "-Infinity"
+	}
+	return k.r.FloatString(k.dscale)
+}
+
+// returns the number as a string (see NumericValue for arithmetic)
+func (k *pgNumeric) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgNumeric) Rat() *big.Rat {
+	if !k.valid || k.nan || k.inf != 0 {
+		return nil
+	}
+	return new(big.Rat).Set(k.r)
+}
+
+func (k *pgNumeric) NaN() bool {
+	return k.valid && k.nan
+}
+
+func (k *pgNumeric) Infinity() int {
+	if !k.valid {
+		return 0
+	}
+	return k.inf
+}
+
+func (k *pgNumeric) Scale() int {
+	return k.dscale
+}
+
+// the Valstructor for sum results of col c. Numeric cols use an
+// unconstrained Numeric so the sum is exact and cannot overflow
+func sumKind(c *Column) Valstructor {
+	v, err := c.k(nil)
+	if err != nil {
+		return c.k
+	}
+	if _, ok := v.(*pgNumeric); ok {
+		return Numeric(0, 0)
+	}
+	return c.k
+}
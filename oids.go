@@ -3,21 +3,27 @@ package pqutil
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
-// load all the known standard oids/Valstructors into the type map
-// this map is used by DB to convert col info into a Valstructor
-var typs = map[uint32]func(args ...string) (Valstructor, error){
+// a func that builds a Valstructor for a type given the type
+// modifiers from the column definition ie. ["5"] for varchar(5)
+type TypeFunc func(args ...string) (Valstructor, error)
 
-	16: func(args ...string) (Valstructor, error) {
+// the default Valstructors for types by schema qualified pg_type name.
+// DB uses these (after any registered with DB.RegisterType) to convert
+// col info into a Valstructor. Add to it with RegisterType
+var typs = map[string]TypeFunc{
+
+	"pg_catalog.bool": func(args ...string) (Valstructor, error) {
 		return Bool, nil
 	},
 
-	17: func(args ...string) (Valstructor, error) {
+	"pg_catalog.bytea": func(args ...string) (Valstructor, error) {
 		return Bytea, nil
 	},
 
-	18: func(args ...string) (Valstructor, error) {
+	"pg_catalog.char": func(args ...string) (Valstructor, error) {
 		vs, err := argsToInts(args, 1)
 		if err != nil {
 			return nil, err
@@ -25,35 +31,35 @@ var typs = map[uint32]func(args ...string) (Valstructor, error){
 		return Char(vs[0]), nil
 	},
 
-	20: func(args ...string) (Valstructor, error) {
+	"pg_catalog.int8": func(args ...string) (Valstructor, error) {
 		return BigInt, nil
 	},
 
-	21: func(args ...string) (Valstructor, error) {
+	"pg_catalog.int2": func(args ...string) (Valstructor, error) {
 		return SmallInt, nil
 	},
 
-	23: func(args ...string) (Valstructor, error) {
+	"pg_catalog.int4": func(args ...string) (Valstructor, error) {
 		return Integer, nil
 	},
 
-	25: func(args ...string) (Valstructor, error) {
+	"pg_catalog.text": func(args ...string) (Valstructor, error) {
 		return Text, nil
 	},
 
-	26: func(args ...string) (Valstructor, error) {
+	"pg_catalog.oid": func(args ...string) (Valstructor, error) {
 		return Integer, nil
 	},
 
-	700: func(args ...string) (Valstructor, error) {
+	"pg_catalog.float4": func(args ...string) (Valstructor, error) {
 		return Real, nil
 	},
 
-	701: func(args ...string) (Valstructor, error) {
+	"pg_catalog.float8": func(args ...string) (Valstructor, error) {
 		return Double, nil
 	},
 
-	1042: func(args ...string) (Valstructor, error) {
+	"pg_catalog.bpchar": func(args ...string) (Valstructor, error) {
 		vs, err := argsToInts(args, 1)
 		if err != nil {
 			return nil, err
@@ -61,7 +67,7 @@ var typs = map[uint32]func(args ...string) (Valstructor, error){
 		return Char(vs[0]), nil
 	},
 
-	1043: func(args ...string) (Valstructor, error) {
+	"pg_catalog.varchar": func(args ...string) (Valstructor, error) {
 		vs, err := argsToInts(args, 1)
 		if err != nil {
 			return nil, err
@@ -69,31 +75,99 @@ var typs = map[uint32]func(args ...string) (Valstructor, error){
 		return VarChar(vs[0]), nil
 	},
 
-	1114: func(args ...string) (Valstructor, error) {
-		return Timestamp, nil
+	"pg_catalog.date": func(args ...string) (Valstructor, error) {
+		return Date, nil
 	},
 
-	1184: func(args ...string) (Valstructor, error) {
+	"pg_catalog.time": func(args ...string) (Valstructor, error) {
+		return Time, nil
+	},
+
+	"pg_catalog.timetz": func(args ...string) (Valstructor, error) {
+		return TimeTZ, nil
+	},
+
+	"pg_catalog.interval": func(args ...string) (Valstructor, error) {
+		return Interval, nil
+	},
+
+	"pg_catalog.timestamp": func(args ...string) (Valstructor, error) {
 		return Timestamp, nil
 	},
 
-	1700: func(args ...string) (Valstructor, error) {
-		vs, err := argsToInts(args, 1)
+	"pg_catalog.timestamptz": func(args ...string) (Valstructor, error) {
+		return TimestampTZ, nil
+	},
+
+	"pg_catalog.numeric": func(args ...string) (Valstructor, error) {
+		// NUMERIC is unconstrained and NUMERIC(p) has a scale of 0
+		vs, err := argsToInts(args, 0)
 		if err != nil {
 			return nil, err
 		}
-		if len(vs) < 2 {
-			vs = append(vs, 2)
+		for len(vs) < 2 {
+			vs = append(vs, 0)
 		}
 		return Numeric(vs[0], vs[1]), nil
 	},
 
-	// JSONB
-	3802: func(args ...string) (Valstructor, error) {
-		return Bytea, nil
+	"pg_catalog.json": func(args ...string) (Valstructor, error) {
+		return JSON, nil
+	},
+
+	"pg_catalog.jsonb": func(args ...string) (Valstructor, error) {
+		return JSONB, nil
+	},
+
+	"pg_catalog.uuid": func(args ...string) (Valstructor, error) {
+		return UUID, nil
+	},
+
+	"pg_catalog.tsvector": func(args ...string) (Valstructor, error) {
+		return Text, nil
+	},
+
+	// extension types (so oids and schema vary between dbs)
+	"hstore": func(args ...string) (Valstructor, error) {
+		return HStore, nil
 	},
 }
 
+// Register fn as the default way to build Valstructors for the pg_type
+// with the given name for all DBs. The name can be schema qualified
+// (ie. "myschema.money") to only match the type in that schema or plain
+// (ie. "citext" or "jsonb") to match the type in any schema. Replaces any
+// existing type of that name including the built-ins.
+// Not safe to call while any DB is loading Relations; call it from init
+func RegisterType(name string, fn func(args ...string) (Valstructor, error)) {
+	typs[name] = fn
+	if !strings.Contains(name, ".") {
+		delete(typs, "pg_catalog."+name)
+	}
+}
+
+// Register fn to build Valstructors for the pg_type with the given name
+// (schema qualified or not, see RegisterType) for this DB only. Takes
+// precedence over the package level RegisterType.
+// Must be called before Relations are loaded
+func (db *DB) RegisterType(name string, fn func(args ...string) (Valstructor, error)) {
+	db.types[name] = fn
+}
+
+// return the TypeFunc for the type name in schema nsp or nil if none
+// registered. A schema qualified name is preferred to a plain one
+func (db *DB) typeFunc(nsp string, name string) TypeFunc {
+	for _, types := range []map[string]TypeFunc{db.types, typs} {
+		if f, ok := types[nsp+"."+name]; ok {
+			return f
+		}
+		if f, ok := types[name]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
 func argsToInts(args []string, need int) (ints []int, err error) {
 	if len(args) < need {
 		return nil, fmt.Errorf("need at least %d args", need)
@@ -108,3 +182,17 @@ func argsToInts(args []string, need int) (ints []int, err error) {
 	}
 	return ints, nil
 }
+
+// the default fallback for base types that are not implemented.
+// Values are kept as the text sent by the db (see Opaque)
+func OpaqueFallback(name string, oid uint32) (Valstructor, error) {
+	return Opaque(name), nil
+}
+
+// Set the func used to create a Valstructor for base and range types
+// that pql does not implement (citext, ltree, tsrange etc). The default
+// is OpaqueFallback. Pass nil to make loading a Relation with an
+// unknown type an error. Must be called before Relations are loaded
+func (db *DB) SetTypeFallback(fn func(name string, oid uint32) (Valstructor, error)) {
+	db.typeFallback = fn
+}
@@ -0,0 +1,188 @@
+package pqutil
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// the placeholder shown in place of sensitive column values
+const Redacted = "[REDACTED]"
+
+// a pattern matching commonly sensitive column names (password,
+// token etc) to opt in to with DB.SetSensitivePattern
+var DefaultSensitivePattern = regexp.MustCompile(`(?i)(^|_)(password|passwd|secret|token|api_?key|salt)(_|$)`)
+
+// a column with this tag in its comment is treated as sensitive.
+//
+//	COMMENT ON COLUMN account.pin IS '@sensitive';
+const SensitiveTag = "@sensitive"
+
+// Set the pattern used to mark columns as sensitive by name
+// (ie. DefaultSensitivePattern). The default is nil which only uses
+// MarkSensitive and column comments. Must be called before
+// Relations are loaded
+func (db *DB) SetSensitivePattern(re *regexp.Regexp) {
+	db.sensitivePat = re
+}
+
+// Mark the named cols of relation relname as sensitive so that their
+// values are shown as [REDACTED] by RecordValue.String(), in hook
+// args and in error messages
+func (db *DB) MarkSensitive(relname string, cols ...string) error {
+	if db.sensitive == nil {
+		db.sensitive = make(map[string]bool)
+	}
+	for _, name := range cols {
+		db.sensitive[relname+"."+name] = true
+	}
+	if db.rels == nil {
+		return nil
+	}
+	// relations already loaded so update them too
+	r, ok := db.rels[relname]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoRelation, relname)
+	}
+	for _, name := range cols {
+		c := r.col(name)
+		if c == nil {
+			return fmt.Errorf("%w %s for %s", ErrUnknownColumn, name, relname)
+		}
+		c.sensitive = true
+	}
+	return nil
+}
+
+// decide which of r's cols are sensitive
+func (db *DB) markSensitive(r *Relation) {
+	for _, c := range r.cols {
+		switch {
+		case strings.Contains(c.comment, SensitiveTag):
+			c.sensitive = true
+		case db.sensitive[r.Name+"."+c.name]:
+			c.sensitive = true
+		case db.sensitivePat != nil && db.sensitivePat.MatchString(c.name):
+			c.sensitive = true
+		}
+	}
+}
+
+// return the names of the relation's sensitive cols
+func (r *Relation) Sensitive() []string {
+	names := make([]string, 0)
+	for _, c := range r.cols {
+		if c.sensitive {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// wrapped is just Value but named so that secret can embed it
+// without the field name hiding the Value method
+type wrapped interface {
+	Value
+}
+
+// a Value from a sensitive col. It behaves exactly like the
+// wrapped Value when talking to the db but never shows the value
+// in String() or errors
+type secret struct {
+	wrapped
+	name string
+}
+
+func (s secret) String() string {
+	return Redacted
+}
+
+func (s secret) Scan(src interface{}) error {
+	err := s.wrapped.Scan(src)
+	if err != nil {
+		// the wrapped error is dropped as its message (or any error it
+		// wraps) can include the value
+		return fmt.Errorf("cannot set sensitive column %s to %s: %w", s.name, Redacted, ErrSensitiveValue)
+	}
+	return nil
+}
+
+// a query param bound to a sensitive col. It is passed to the db
+// as is but shown as [REDACTED] in hook args
+type secretArg struct {
+	v interface{}
+}
+
+func (a secretArg) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(a.v)
+}
+
+func (a secretArg) String() string {
+	return Redacted
+}
+
+// wrap v as a secret if c is sensitive
+func hide(c *Column, v Value) Value {
+	if c == nil || !c.sensitive || v == nil {
+		return v
+	}
+	return secret{v, c.name}
+}
+
+// wrap the param a so it is redacted if it is bound to c and c is sensitive
+func hideArg(c *Column, a interface{}) interface{} {
+	if c == nil || !c.sensitive {
+		return a
+	}
+	switch v := a.(type) {
+	case secret, secretArg:
+		return a
+	case Value:
+		return hide(c, v)
+	}
+	return secretArg{a}
+}
+
+// wrap the params for a Where filter w that mentions any of r's
+// sensitive cols. The params can't be matched to the cols so all of
+// them are redacted
+func hideParams(r *Relation, w string, params []interface{}) []interface{} {
+	if r == nil || len(params) == 0 {
+		return params
+	}
+	var c *Column
+	for _, word := range strings.FieldsFunc(w, notIdent) {
+		if rc := r.col(word); rc != nil && rc.sensitive {
+			c = rc
+			break
+		}
+	}
+	if c == nil {
+		return params
+	}
+	out := make([]interface{}, len(params))
+	for i, a := range params {
+		out[i] = hideArg(c, a)
+	}
+	return out
+}
+
+// is r not part of an SQL identifier
+func notIdent(r rune) bool {
+	return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// copy args replacing any sensitive values with Redacted
+func redactArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		switch a.(type) {
+		case secret, secretArg:
+			a = Redacted
+		}
+		out[i] = a
+	}
+	return out
+}
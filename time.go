@@ -0,0 +1,320 @@
+package pqutil
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the kind of date/time a pgTime holds
+type timeKind int
+
+const (
+	kDate timeKind = iota
+	kTime
+	kTimeTZ
+	kTimestamp
+	kTimestampTZ
+)
+
+var timeKindNames = [...]string{"DATE", "TIME", "TIMETZ", "TIMESTAMP", "TIMESTAMPTZ"}
+
+// TimeValue is the Value for date, time, timetz, timestamp
+// and timestamptz columns
+type TimeValue interface {
+	Value
+	// the time. For DATE, TIME and TIMESTAMP the location is always
+	// UTC and only the wall clock fields are meaningful. For TIME and
+	// TIMETZ the date is 0000-01-01
+	Time() time.Time
+	// 1 for 'infinity', -1 for '-infinity' otherwise 0
+	Infinity() int
+}
+
+// Valstructor for DATE columns
+func Date(data interface{}) (Value, error) {
+	return newTime(kDate, data)
+}
+
+// Valstructor for TIME (without time zone) columns
+func Time(data interface{}) (Value, error) {
+	return newTime(kTime, data)
+}
+
+// Valstructor for TIMETZ columns
+func TimeTZ(data interface{}) (Value, error) {
+	return newTime(kTimeTZ, data)
+}
+
+// Valstructor for TIMESTAMP (without time zone) columns
+func Timestamp(data interface{}) (Value, error) {
+	return newTime(kTimestamp, data)
+}
+
+// Valstructor for TIMESTAMPTZ columns
+func TimestampTZ(data interface{}) (Value, error) {
+	return newTime(kTimestampTZ, data)
+}
+
+func newTime(kind timeKind, data interface{}) (Value, error) {
+	k := &pgTime{kind: kind}
+	return k, k.Scan(data)
+}
+
+type pgTime struct {
+	t     time.Time
+	kind  timeKind
+	inf   int // 1 = infinity, -1 = -infinity
+	valid bool
+}
+
+// matches the ISO style date/time text used by postgres
+// ie. 2001-02-03 04:05:06.789+05:30 with any part optional
+var timePat = regexp.MustCompile(`^(?:(\d{4,})-(\d{1,2})-(\d{1,2}))?(?:[ T]?(\d{1,2}):(\d{2})(?::(\d{2})(?:\.(\d{1,9}))?)?)?\s*(Z|[+-]\d{1,2}(?::?\d{2}(?::?\d{2})?)?)?$`)
+
+// parse the text s into k.t as per k.kind.
+// Values without an offset for TIMETZ and TIMESTAMPTZ are taken
+// to be UTC (unlike postgres which uses the session TimeZone)
+func (k *pgTime) parse(s string) error {
+	s = strings.TrimSpace(s)
+	k.inf = 0
+	switch s {
+	case "infinity", "+infinity", "-infinity":
+		if k.kind == kTime || k.kind == kTimeTZ {
+			return fmt.Errorf("%s Value cannot be %s", timeKindNames[k.kind], s)
+		}
+		k.inf = 1
+		if s[0] == '-' {
+			k.inf = -1
+		}
+		k.t = time.Time{}
+		return nil
+	}
+	bc := strings.HasSuffix(s, " BC")
+	s = strings.TrimSuffix(s, " BC")
+	m := timePat.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[4] == "") {
+		return fmt.Errorf("could not parse %s string %s", timeKindNames[k.kind], s)
+	}
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	year, month, day := 0, 1, 1
+	switch {
+	case m[1] != "":
+		year, month, day = atoi(m[1]), atoi(m[2]), atoi(m[3])
+		if bc {
+			// there is no year 0 so 1 BC is year 0
+			year = 1 - year
+		}
+	case k.kind != kTime && k.kind != kTimeTZ:
+		return fmt.Errorf("could not parse %s string %s: missing date", timeKindNames[k.kind], s)
+	}
+	hour, min, sec, nsec := atoi(m[4]), atoi(m[5]), atoi(m[6]), 0
+	if m[7] != "" {
+		nsec = atoi((m[7] + "00000000")[:9])
+	}
+	if (k.kind == kTime || k.kind == kTimeTZ) && m[4] == "" {
+		return fmt.Errorf("could not parse %s string %s: missing time", timeKindNames[k.kind], s)
+	}
+	loc := time.UTC
+	if m[8] != "" && (k.kind == kTimeTZ || k.kind == kTimestampTZ) {
+		loc = parseOffset(m[8])
+	}
+	switch k.kind {
+	case kDate:
+		hour, min, sec, nsec = 0, 0, 0, 0
+	case kTime, kTimeTZ:
+		year, month, day = 0, 1, 1
+	}
+	// only 24:00:00 is allowed past 23:59:59 (it is midnight at the end of the day)
+	if hour > 24 || min > 59 || sec > 59 || (hour == 24 && (min != 0 || sec != 0 || nsec != 0)) {
+		return fmt.Errorf("could not parse %s string %s: invalid time", timeKindNames[k.kind], s)
+	}
+	// check the date before the clock can roll it into the next day
+	d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if d.Month() != time.Month(month) || d.Day() != day {
+		return fmt.Errorf("could not parse %s string %s: invalid date", timeKindNames[k.kind], s)
+	}
+	k.t = time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc)
+	return nil
+}
+
+// convert a +HH[:MM[:SS]] (or Z) offset into a fixed zone
+func parseOffset(s string) *time.Location {
+	if s == "Z" {
+		return time.UTC
+	}
+	digits := strings.Replace(s[1:], ":", "", -1)
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	secs := 0
+	for _, mul := range []int{3600, 60, 1} {
+		if len(digits) < 2 {
+			break
+		}
+		n, _ := strconv.Atoi(digits[:2])
+		secs += n * mul
+		digits = digits[2:]
+	}
+	if s[0] == '-' {
+		secs = -secs
+	}
+	if secs == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", secs)
+}
+
+func (k *pgTime) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case time.Time:
+		k.inf = 0
+		k.t = k.fromTime(x)
+	case string:
+		return k.parse(x)
+	case []byte:
+		return k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set %s value with %T -> %v", timeKindNames[k.kind], src, src)
+	}
+	return nil
+}
+
+// convert t to the form held for k.kind. Kinds without a time zone
+// keep the wall clock of t rather than converting to UTC
+func (k *pgTime) fromTime(t time.Time) time.Time {
+	// keep 24:00:00 (see fmtClock)
+	day := 1
+	if t.Year() == 0 && t.YearDay() == 2 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		day = 2
+	}
+	switch k.kind {
+	case kDate:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case kTime:
+		return time.Date(0, 1, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	case kTimeTZ:
+		return time.Date(0, 1, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	case kTimestamp:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	return t
+}
+
+func (k *pgTime) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgTime) Time() time.Time {
+	return k.t
+}
+
+func (k *pgTime) Infinity() int {
+	return k.inf
+}
+
+// the text sent to the db is the same as String()
+func (k *pgTime) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgTime) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullb, nil
+	}
+	return []byte(k.String()), nil
+}
+
+// return the ISO style text postgres uses for the kind
+// ie. 2001-02-03 04:05:06.5+05:30
+func (k *pgTime) String() string {
+	if !k.valid {
+		return ""
+	}
+	switch k.inf {
+	case 1:
+		return "infinity"
+	case -1:
+		return "-infinity"
+	}
+	t := k.t
+	var s string
+	switch k.kind {
+	case kDate:
+		s = fmtDate(t)
+	case kTime:
+		s = fmtClock(t)
+	case kTimeTZ:
+		s = fmtClock(t) + fmtOffset(t)
+	case kTimestamp:
+		s = fmtDate(t) + " " + fmtClock(t)
+	case kTimestampTZ:
+		s = fmtDate(t) + " " + fmtClock(t) + fmtOffset(t)
+	}
+	if k.kind != kTime && k.kind != kTimeTZ && t.Year() <= 0 {
+		s += " BC"
+	}
+	return s
+}
+
+// returns the time.Time (or "infinity"/"-infinity")
+func (k *pgTime) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	if k.inf != 0 {
+		return k.String()
+	}
+	return k.t
+}
+
+func fmtDate(t time.Time) string {
+	y := t.Year()
+	if y <= 0 {
+		y = 1 - y
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", y, t.Month(), t.Day())
+}
+
+func fmtClock(t time.Time) string {
+	if t.Year() == 0 && t.Day() == 2 {
+		// TIME allows 24:00:00 which time.Date rolls into the next day
+		return "24:00:00"
+	}
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
+	if ns := t.Nanosecond(); ns != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", ns), "0")
+	}
+	return s
+}
+
+func fmtOffset(t time.Time) string {
+	_, off := t.Zone()
+	sign := "+"
+	if off < 0 {
+		sign = "-"
+		off = -off
+	}
+	s := fmt.Sprintf("%s%02d", sign, off/3600)
+	if off%3600 != 0 {
+		s += fmt.Sprintf(":%02d", off%3600/60)
+	}
+	if off%60 != 0 {
+		s += fmt.Sprintf(":%02d", off%60)
+	}
+	return s
+}
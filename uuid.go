@@ -0,0 +1,179 @@
+package pqutil
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UUIDValue is the Value for UUID columns
+type UUIDValue interface {
+	Value
+	// return the 16 bytes of the UUID
+	UUID() [16]byte
+	// return the version number in the UUID (ie. 4 or 7)
+	Version() int
+}
+
+// Valstructor for UUID columns. Accepts a [16]byte, a 16 byte slice
+// or text in the canonical, braced ({...}) or hyphenless forms
+func UUID(data interface{}) (Value, error) {
+	k := new(pgUUID)
+	return k, k.Scan(data)
+}
+
+type pgUUID struct {
+	b     [16]byte
+	valid bool
+}
+
+func (k *pgUUID) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	switch x := src.(type) {
+	case [16]byte:
+		k.b = x
+	case []byte:
+		if len(x) == 16 {
+			copy(k.b[:], x)
+			break
+		}
+		return k.parse(string(x))
+	case string:
+		return k.parse(x)
+	default:
+		return fmt.Errorf("cannot set UUID value with %T -> %v", src, src)
+	}
+	k.valid = true
+	return nil
+}
+
+// parse the text form of a UUID
+func (k *pgUUID) parse(s string) error {
+	// left NULL if s is not a valid UUID
+	k.valid = false
+	h := s
+	if strings.HasPrefix(h, "{") && strings.HasSuffix(h, "}") {
+		h = h[1 : len(h)-1]
+	}
+	if len(h) == 36 {
+		if h[8] != '-' || h[13] != '-' || h[18] != '-' || h[23] != '-' {
+			return fmt.Errorf("invalid UUID %s", s)
+		}
+		h = h[0:8] + h[9:13] + h[14:18] + h[19:23] + h[24:]
+	}
+	if len(h) != 32 {
+		return fmt.Errorf("invalid UUID %s", s)
+	}
+	var b [16]byte
+	_, err := hex.Decode(b[:], []byte(h))
+	if err != nil {
+		return fmt.Errorf("invalid UUID %s", s)
+	}
+	k.b = b
+	k.valid = true
+	return nil
+}
+
+func (k *pgUUID) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgUUID) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgUUID) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullb, nil
+	}
+	return []byte(k.String()), nil
+}
+
+// return the canonical lowercase hyphenated form
+func (k *pgUUID) String() string {
+	if !k.valid {
+		return ""
+	}
+	h := hex.EncodeToString(k.b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func (k *pgUUID) UUID() [16]byte {
+	return k.b
+}
+
+func (k *pgUUID) Version() int {
+	return int(k.b[6] >> 4)
+}
+
+// returns the UUID as a [16]byte
+func (k *pgUUID) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.b
+}
+
+// generate a random (version 4) UUID
+func NewUUIDv4() ([16]byte, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return b, err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return b, nil
+}
+
+// generate a time ordered (version 7) UUID
+func NewUUIDv7() ([16]byte, error) {
+	var b [16]byte
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return b, err
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(b[0:6], ms[2:])
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return b, nil
+}
+
+// Set a func (ie. NewUUIDv4 or NewUUIDv7) to generate ids when
+// inserting a record with a NULL uuid primary key that has no DEFAULT.
+// Pass nil (the default) to leave it to the db
+func (db *DB) SetUUIDGenerator(gen func() ([16]byte, error)) {
+	db.uuidGen = gen
+}
+
+// fill in a NULL uuid pk of v using the generator (if any)
+func (db *DB) generateID(v RecordValue) error {
+	if db.uuidGen == nil || v.Relation() == nil {
+		return nil
+	}
+	pk := v.Relation().pk()
+	if pk == nil || pk.hasDef {
+		return nil
+	}
+	pv, ok := v.ValueBy(pk.name).(*pgUUID)
+	if !ok || !pv.IsNull() {
+		return nil
+	}
+	id, err := db.uuidGen()
+	if err != nil {
+		return err
+	}
+	return pv.Scan(id)
+}
@@ -0,0 +1,328 @@
+package pqutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field failed validation
+type FieldError struct {
+	Field string // the col name
+	Rule  string // the rule that failed: "not null", "length", "enum", "numeric" or "check"
+	Msg   string // human readable description
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Msg)
+}
+
+// ValidationError is returned by Validate and lists
+// every field that failed validation
+type ValidationError struct {
+	Relation string
+	Fields   []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Relation, strings.Join(msgs, ", "))
+}
+
+// return the errors for the named field (if any)
+func (e *ValidationError) Field(name string) []*FieldError {
+	var fes []*FieldError
+	for _, f := range e.Fields {
+		if f.Field == name {
+			fes = append(fes, f)
+		}
+	}
+	return fes
+}
+
+// Values that know the limits of their type
+type validator interface {
+	// return a description of why the value is invalid or ""
+	validate() string
+}
+
+func (k *pgText) validate() string {
+	if k.long > 0 {
+		return fmt.Sprintf("must be at most %d characters (got %d)", k.n, k.long)
+	}
+	return ""
+}
+
+func (k *pgEnum) validate() string {
+	if !k.valid {
+		return ""
+	}
+	for _, l := range k.ls {
+		if k.s == l {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be one of %s", strings.Join(k.ls, ","))
+}
+
+func (k *pgNumeric) validate() string {
+	if !k.overflow() {
+		return ""
+	}
+	return fmt.Sprintf("does not fit NUMERIC(%d,%d)", k.prec, k.scale)
+}
+
+// check the value v for col c
+func (c *Column) validate(v Value) []*FieldError {
+	if v == nil || v.IsNull() {
+		// NULL is fine if there is a DEFAULT to fill it in
+		if (c.notNull || (c.dom != nil && c.dom.notNull && !c.dom.array)) && !c.hasDef {
+			return []*FieldError{{c.name, "not null", "cannot be NULL"}}
+		}
+		return nil
+	}
+	var fes []*FieldError
+	if msg, rule := validateValue(v); msg != "" {
+		fes = append(fes, &FieldError{c.name, rule, msg})
+	}
+	if c.dom != nil {
+		fes = append(fes, c.dom.validate(c.name, v)...)
+	}
+	return fes
+}
+
+// check v against the limits of its type returning
+// a description of the problem and the rule broken
+func validateValue(v Value) (string, string) {
+	vk, ok := v.(validator)
+	if !ok {
+		return "", ""
+	}
+	msg := vk.validate()
+	if msg == "" {
+		return "", ""
+	}
+	rule := "length"
+	switch v.(type) {
+	case *pgEnum:
+		rule = "enum"
+	case *pgNumeric:
+		rule = "numeric"
+	}
+	return msg, rule
+}
+
+// Check v against the NOT NULL, length, enum, numeric precision and
+// (simple) CHECK constraints of the relation. Returns a *ValidationError
+// listing every invalid field or nil if v looks ok
+func (r *Relation) Validate(v RecordValue) error {
+	return validate(r.Name, r.cols, r.cons, v)
+}
+
+func (k *pgRecord) Validate() error {
+	if k.rel != nil {
+		return k.rel.Validate(k)
+	}
+	return validate("record", k.cs, nil, k)
+}
+
+func validate(name string, cols []*Column, cons []*Constraint, v RecordValue) error {
+	var fes []*FieldError
+	for _, c := range cols {
+		fes = append(fes, c.validate(v.ValueBy(c.name))...)
+	}
+	for _, con := range cons {
+		fes = append(fes, con.validate(v)...)
+	}
+	if len(fes) == 0 {
+		return nil
+	}
+	return &ValidationError{name, fes}
+}
+
+// a single `col op literal` or `length(col) op literal` comparison
+type checkTerm struct {
+	col    string
+	length bool // compare length(col) rather than col
+	op     string
+	lit    string
+	num    bool           // is lit a number
+	re     *regexp.Regexp // lit compiled for the ~ ops
+}
+
+// matches terms like: (age >= 0), (length(name) > 0), (kind <> 'x'::text)
+// and for domains: ((VALUE)::text ~ '^[^@]+@'::text)
+var checkTermPat = regexp.MustCompile(`^(?:\(?(\w+)\)?(?:::[\w ]+)?|(?:char_)?length\(\(?(\w+)\)?(?:::[\w ]+)?\)) (!~\*|!~|~\*|~|>=|<=|<>|!=|=|>|<) \(?(?:'((?:[^']|'')*)'|(-?[\d.]+))\)?(?:::([\w ]+))?$`)
+
+// casts that make a quoted literal a number
+var numericCasts = map[string]bool{
+	"smallint": true, "integer": true, "bigint": true, "numeric": true,
+	"real": true, "double precision": true,
+}
+
+// break a CHECK constraint def into the terms we can evaluate.
+// Only ANDed comparisons are understood, anything else is left
+// for the db to check
+func parseCheck(def string) []*checkTerm {
+	s := strings.TrimPrefix(def, "CHECK ")
+	s = strings.TrimSuffix(s, " NOT VALID")
+	var terms []*checkTerm
+	for _, part := range splitAnd(unparen(s)) {
+		m := checkTermPat.FindStringSubmatch(unparen(part))
+		if m == nil {
+			continue
+		}
+		t := &checkTerm{col: m[1], op: m[3], lit: m[4]}
+		if t.col == "" {
+			t.col = m[2]
+			t.length = true
+		}
+		if m[5] != "" {
+			t.lit = m[5]
+			t.num = true
+		} else {
+			t.lit = strings.Replace(t.lit, "''", "'", -1)
+			t.num = numericCasts[m[6]]
+		}
+		if strings.Contains(t.op, "~") {
+			pat := t.lit
+			if strings.HasSuffix(t.op, "*") {
+				pat = "(?i)" + pat
+			}
+			// POSIX regexs that Go cannot handle are left for the db
+			re, err := regexp.Compile(pat)
+			if err != nil {
+				continue
+			}
+			t.re = re
+		}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// strip any parens that wrap the whole of s
+func unparen(s string) string {
+	for len(s) > 1 && s[0] == '(' && s[len(s)-1] == ')' && closing(s, 0) == len(s)-1 {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// index of the paren closing the one at i (ignoring quoted parens)
+func closing(s string, i int) int {
+	depth := 0
+	quoted := false
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// split s on top level ANDs. If there is a top level OR
+// then nothing can be safely checked so nil is returned
+func splitAnd(s string) []string {
+	var parts []string
+	depth := 0
+	quoted := false
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], " OR "):
+			return nil
+		case depth == 0 && strings.HasPrefix(s[i:], " AND "):
+			parts = append(parts, s[last:i])
+			last = i + len(" AND ")
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// evaluate the understood terms of a CHECK against v
+func (con *Constraint) validate(v RecordValue) []*FieldError {
+	var fes []*FieldError
+	for _, t := range con.terms {
+		x := v.ValueBy(t.col)
+		if x == nil || x.IsNull() {
+			// NULL passes a CHECK
+			continue
+		}
+		if !t.ok(x) {
+			fes = append(fes, &FieldError{t.col, "check", fmt.Sprintf("violates %s", con.name)})
+		}
+	}
+	return fes
+}
+
+// compare the Value with the term's literal
+func (t *checkTerm) ok(v Value) bool {
+	var cmp int
+	s := v.String()
+	switch {
+	case t.re != nil:
+		return t.re.MatchString(s) != strings.HasPrefix(t.op, "!")
+	case t.length:
+		n, err := strconv.Atoi(t.lit)
+		if err != nil {
+			return true
+		}
+		cmp = utf8.RuneCountInString(s) - n
+	case t.num:
+		a, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return true
+		}
+		b, _ := strconv.ParseFloat(t.lit, 64)
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	default:
+		// ordering of strings depends on the db collation
+		// so only equality can be checked here
+		if t.op != "=" && t.op != "<>" && t.op != "!=" {
+			return true
+		}
+		cmp = strings.Compare(s, t.lit)
+	}
+	switch t.op {
+	case "=":
+		return cmp == 0
+	case "<>", "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return true
+}
@@ -10,7 +10,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 )
 
 var nullb = []byte("NULL")
@@ -336,6 +336,10 @@ type RecordValue interface {
 	Relation() *Relation
 	// Set the parent relation for this RecordValue
 	SetRelation(*Relation)
+	// Create a Query for the named reference of this record's Relation
+	From(refname string) *Query
+	// Check the values against the schema. Returns nil or a *ValidationError
+	Validate() error
 }
 
 // A `Valstructor` creates and initializes a new
@@ -470,8 +474,8 @@ func (k *pgRow) bytes() ([]byte, error) {
 //
 //    name := v.Get("name").String()
 //
-func Col(name string, k Valstructor) *col {
-	c := new(col)
+func Col(name string, k Valstructor) *Column {
+	c := new(Column)
 	c.k = k
 	c.name = name
 	return c
@@ -480,7 +484,7 @@ func Col(name string, k Valstructor) *col {
 // same as Row, but takes a list of Col's
 // as arguments that allow you to name the
 // fields
-func Record(cols ...*col) Valstructor {
+func Record(cols ...*Column) Valstructor {
 	return func(data interface{}) (v Value, err error) {
 		k := new(pgRecord)
 		k.cs = cols
@@ -498,7 +502,7 @@ func Record(cols ...*col) Valstructor {
 
 type pgRecord struct {
 	vs    []Value
-	cs    []*col
+	cs    []*Column
 	valid bool
 	rel   *Relation
 }
@@ -521,7 +525,17 @@ func (k *pgRecord) Scan(src interface{}) (err error) {
 		return nil
 	}
 	k.valid = true
-	return rowScanner(src, k.vs)
+	return rowScanner(src, k.dests())
+}
+
+// the record's values with any sensitive ones wrapped
+// so that scan errors do not leak their content
+func (k *pgRecord) dests() []Value {
+	vs := make([]Value, len(k.vs))
+	for i, v := range k.vs {
+		vs[i] = hide(k.cs[i], v)
+	}
+	return vs
 }
 
 func (k *pgRecord) Value() (driver.Value, error) {
@@ -531,11 +545,20 @@ func (k *pgRecord) Value() (driver.Value, error) {
 	return k.bytes()
 }
 
+// same as the Value's text form but with the content of
+// any sensitive cols replaced with [REDACTED]
 func (k *pgRecord) String() string {
 	if !k.valid {
 		return ""
 	}
-	s, _ := k.bytes()
+	vs := make([]Value, len(k.vs))
+	for i, v := range k.vs {
+		vs[i] = v
+		if k.cs[i].sensitive && !v.IsNull() {
+			vs[i], _ = Text(Redacted)
+		}
+	}
+	s, _ := rowBytes(k.valid, vs)
 	return string(s)
 }
 
@@ -584,11 +607,12 @@ func (k *pgRecord) Get(name string) interface{} {
 }
 
 func (k *pgRecord) Set(name string, src interface{}) error {
-	v := k.ValueBy(name)
-	if v == nil {
-		return fmt.Errorf("No column %s", name)
+	for i, c := range k.cs {
+		if c.name == name {
+			return hide(c, k.vs[i]).Scan(src)
+		}
 	}
-	return v.Scan(src)
+	return fmt.Errorf("%w %s", ErrUnknownColumn, name)
 }
 
 func (k *pgRecord) Append(src interface{}) error {
@@ -627,9 +651,24 @@ func (k *pgRecord) bytes() ([]byte, error) {
 	return rowBytes(k.valid, k.vs)
 }
 
-// return a Query for a referenced table
-func (k *pgRecord) From(refname string) {
-
+// return a Query for a referenced table.
+// refname is the name of a has-one (location_id -> "location") or
+// has-many ("person") reference on the record's Relation.
+// The Query is run against the Relation's DB (not any current Tx)
+func (k *pgRecord) From(refname string) *Query {
+	q := new(Query)
+	if k.rel == nil {
+		q.err = fmt.Errorf("RecordValue does not have a relation set")
+		return q
+	}
+	ref := k.rel.refBy(refname)
+	if ref == nil {
+		q.err = fmt.Errorf("No reference %s for %s", refname, k.rel.Name)
+		return q
+	}
+	q.from = ref.rel
+	q.tx = k.rel.db
+	return q.forRef(k, ref)
 }
 
 func Array(el Valstructor) Valstructor {
@@ -712,7 +751,7 @@ func (k *pgArray) bytes() ([]byte, error) {
 			return nil, err
 		}
 		switch child.(type) {
-		case *pgNumeric, *pgInteger, *pgFloat, *pgBool, *pgArray, *pgTimestamp:
+		case *pgNumeric, *pgInteger, *pgFloat, *pgBool, *pgArray:
 			b.Write(cb)
 		default:
 			b.WriteString(`"`)
@@ -857,74 +896,6 @@ func (k *pgInteger) Val() interface{} {
 	return k.n
 }
 
-// stored as string currently
-// TODO: use some Value of arbitary precision for this
-func Numeric(prec int, scale int) Valstructor {
-	return func(data interface{}) (Value, error) {
-		k := &pgNumeric{"", prec, scale, false}
-		return k, k.Scan(data)
-	}
-}
-
-type pgNumeric struct {
-	s     string
-	prec  int
-	scale int
-	valid bool
-}
-
-func (k *pgNumeric) Scan(src interface{}) (err error) {
-	if src == nil {
-		k.valid = false
-		return nil
-	}
-	k.valid = true
-	switch x := src.(type) {
-	case float32:
-		k.s = strconv.FormatFloat(float64(x), 'f', k.scale, 64)
-	case float64:
-		k.s = strconv.FormatFloat(x, 'f', k.scale, 64)
-	case string:
-		k.s = x
-	case []byte:
-		k.s = string(x)
-	default:
-		return fmt.Errorf("cannot set Numeric(%d,%d) Value with %T -> %v", k.prec, k.scale, src, src)
-	}
-	return nil
-}
-func (k *pgNumeric) IsNull() bool {
-	return !k.valid
-}
-
-func (k *pgNumeric) Value() (driver.Value, error) {
-	if !k.valid {
-		return nil, nil
-	}
-	return k.s, nil
-}
-
-func (k *pgNumeric) bytes() ([]byte, error) {
-	if !k.valid {
-		return nullb, nil
-	}
-	return []byte(k.s), nil
-}
-
-func (k *pgNumeric) String() string {
-	if !k.valid {
-		return ""
-	}
-	return k.s
-}
-
-func (k *pgNumeric) Val() interface{} {
-	if !k.valid {
-		return nil
-	}
-	return k.s
-}
-
 // Text field with limited values
 func Enum(labels ...string) Valstructor {
 	if len(labels) == 0 {
@@ -1158,13 +1129,13 @@ func (k *pgBool) Val() interface{} {
 }
 
 func Text(data interface{}) (Value, error) {
-	k := &pgText{"", 0, false, false}
+	k := &pgText{"", 0, false, false, 0}
 	return k, k.Scan(data)
 }
 
 func VarChar(n int) Valstructor {
 	return func(data interface{}) (Value, error) {
-		k := &pgText{"", n, false, false}
+		k := &pgText{"", n, false, false, 0}
 		err := k.Scan(data)
 		if err != nil {
 			return nil, err
@@ -1175,7 +1146,7 @@ func VarChar(n int) Valstructor {
 
 func Char(n int) Valstructor {
 	return func(data interface{}) (Value, error) {
-		k := &pgText{"", n, true, false}
+		k := &pgText{"", n, true, false, 0}
 		err := k.Scan(data)
 		if err != nil {
 			return nil, err
@@ -1189,6 +1160,7 @@ type pgText struct {
 	n     int    // limit to n chars
 	p     bool   // padding
 	valid bool
+	long  int // length in chars before truncating to n (0 if not truncated)
 }
 
 func (k *pgText) Scan(src interface{}) error {
@@ -1216,9 +1188,13 @@ func (k *pgText) Scan(src interface{}) error {
 		if len(k.s) < k.n {
 			k.s = fmt.Sprintf("%-"+strconv.Itoa(k.n)+"s", k.s)
 		}
-	} else if k.n > 0 && len(k.s) > k.n {
+	} else if n := utf8.RuneCountInString(k.s); k.n > 0 && n > k.n {
 		// silently truncate value as per SQL standard
-		k.s = k.s[0:k.n]
+		// but remember so that Validate can complain
+		k.long = n
+		k.s = string([]rune(k.s)[0:k.n])
+	} else {
+		k.long = 0
 	}
 	return nil
 }
@@ -1255,6 +1231,32 @@ func (k *pgText) Val() interface{} {
 	return k.s
 }
 
+// OpaqueValue is a Value of a type that pql does not understand.
+// The db's text representation is passed through as is
+type OpaqueValue interface {
+	Value
+	// the pg_type name of the original type
+	TypeName() string
+}
+
+// Valstructor for values of type typ that are kept as text.
+// Used as the fallback for unknown base types (see DB.SetTypeFallback)
+func Opaque(typ string) Valstructor {
+	return func(data interface{}) (Value, error) {
+		k := &pgOpaque{pgText{"", 0, false, false, 0}, typ}
+		return k, k.Scan(data)
+	}
+}
+
+type pgOpaque struct {
+	pgText
+	typ string
+}
+
+func (k *pgOpaque) TypeName() string {
+	return k.typ
+}
+
 func Bytea(data interface{}) (Value, error) {
 	k := new(pgBytea)
 	return k, k.Scan(data)
@@ -1416,99 +1418,6 @@ func (k *pgHStore) bytes() ([]byte, error) {
 	return bytes.Join(buf, []byte(`,`)), nil
 }
 
-func Timestamp(data interface{}) (Value, error) {
-	k := new(pgTimestamp)
-	return k, k.Scan(data)
-}
-
-type pgTimestamp struct {
-	t     time.Time
-	tz    string
-	valid bool
-}
-
-var timeFormats = []string{
-	"2006-01-02 15:04:05-07",
-	"2006-01-02 15:04:05",
-	"2006-01-02 15:04",
-	"15:04:05-07",
-	"15:04:05",
-	"2006-01-02",
-}
-
-func parseTime(s string, t *time.Time) (err error) {
-	// Special case until time.Parse bug is fixed:
-	// http://code.google.com/p/go/issues/detail?id=3487
-	if s[len(s)-2] == '.' {
-		s += "0"
-	}
-	// check timestampz for a 30-minute-offset timezone
-	// s[len(s)-3] == ':' {
-	// f += ":00"
-
-	// try to parse each format til will find one
-	for _, f := range timeFormats {
-		*t, err = time.Parse(f, s)
-		if err == nil {
-			break
-		} else {
-			err = fmt.Errorf("could not parse time string %s", s)
-		}
-	}
-	return err
-}
-
-func (k *pgTimestamp) Scan(src interface{}) error {
-	if src == nil {
-		k.valid = false
-		return nil
-	}
-	k.valid = true
-	switch x := src.(type) {
-	case time.Time:
-		k.t = x
-	case string:
-		return parseTime(x, &k.t)
-	case []byte:
-		return parseTime(string(x), &k.t)
-	default:
-		return fmt.Errorf("cannot set TIMESTAMP value with %T -> %v", src, src)
-	}
-	return nil
-}
-
-func (k *pgTimestamp) IsNull() bool {
-	return !k.valid
-}
-
-func (k *pgTimestamp) Value() (driver.Value, error) {
-	if !k.valid {
-		return nil, nil
-	}
-	return k.t, nil
-}
-
-func (k *pgTimestamp) bytes() ([]byte, error) {
-	if !k.valid {
-		return nullb, nil
-	}
-	return []byte(k.t.Format(time.RFC3339Nano)), nil
-}
-
-func (k *pgTimestamp) String() string {
-	if !k.valid {
-		return ""
-	}
-	return k.t.Format(time.RFC3339Nano)
-}
-
-func (k *pgTimestamp) Val() interface{} {
-	if !k.valid {
-		return nil
-	}
-	return k.t
-}
-
 // Value aliases
 var (
 	Decimal   = Numeric
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"math"
+	"math/big"
 	"testing"
 	"time"
 
@@ -592,6 +594,101 @@ func TestTextVal(t *testing.T) {
 	}
 }
 
+func TestVarCharLength(t *testing.T) {
+	v, err := VarChar(5)("héllo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := validateValue(v); msg != "" || v.String() != "héllo" {
+		t.Errorf("expected 5 chars to fit VarChar(5) got: %s %s", v, msg)
+	}
+	v, err = VarChar(3)("héllo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "hél" {
+		t.Errorf("expected truncation to 3 chars got: %s", v)
+	}
+	if msg, _ := validateValue(v); msg != "must be at most 3 characters (got 5)" {
+		t.Errorf("unexpected validation message: %s", msg)
+	}
+}
+
+func TestOpaqueVal(t *testing.T) {
+	v, err := Opaque("ltree")([]byte("a.b.c"))
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(string) != "a.b.c" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if name := v.(OpaqueValue).TypeName(); name != "ltree" {
+		t.Errorf("expected ltree type name got: %s", name)
+	}
+	dv, err := v.Value()
+	if err != nil || dv.(string) != "a.b.c" {
+		t.Errorf("expected text round trip got: %v %v", dv, err)
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestJSONVal(t *testing.T) {
+	v, err := JSONB(map[string]interface{}{"a": []int{1, 2}, "b": "x"})
+	if err != nil {
+		t.Error(err)
+	}
+	if v.String() != `{"a":[1,2],"b":"x"}` {
+		t.Errorf("unexpected JSON text: %s", v.String())
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	var dst struct {
+		A []int
+		B string
+	}
+	err = v.(JSONValue).Unmarshal(&dst)
+	if err != nil || len(dst.A) != 2 || dst.B != "x" {
+		t.Errorf("unexpected Unmarshal result: %v %v", dst, err)
+	}
+	raw, err := v.(JSONValue).Path("a", -1)
+	if err != nil || string(raw) != "2" {
+		t.Errorf("expected 2 at path a,-1 got: %s %v", raw, err)
+	}
+	raw, err = v.(JSONValue).Path("nope")
+	if err != nil || raw != nil {
+		t.Errorf("expected nil for missing path got: %s %v", raw, err)
+	}
+	// strings are JSON text
+	err = v.Scan(`[1,`)
+	if err == nil {
+		t.Errorf("expected error for invalid JSON text")
+	}
+	// nested in arrays and records
+	a, err := Array(JSONB)([]interface{}{`{"k": "v"}`})
+	if err != nil {
+		t.Error(err)
+	}
+	if a.String() != `{"{\"k\": \"v\"}"}` {
+		t.Errorf("unexpected JSON array text: %s", a.String())
+	}
+	r, err := Record(Col("j", JSON))([]interface{}{`"s"`})
+	if err != nil {
+		t.Error(err)
+	}
+	if r.String() != `("""s""")` {
+		t.Errorf("unexpected JSON record text: %s", r.String())
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
 func TestByteaVal(t *testing.T) {
 	v, err := Bytea([]byte("aaa"))
 	if err != nil {
@@ -736,6 +833,87 @@ func TestNumericVal(t *testing.T) {
 	}
 }
 
+func TestNumericInputs(t *testing.T) {
+	for _, c := range []struct {
+		k   Valstructor
+		in  interface{}
+		out string
+	}{
+		{Numeric(10, 2), "1.005", "1.01"},
+		{Numeric(10, 2), "-1.005", "-1.01"},
+		{Numeric(10, 2), "1.004", "1.00"},
+		{Numeric(10, 2), 0.1, "0.10"},
+		{Numeric(10, 2), float32(0.1), "0.10"},
+		{Numeric(10, 2), 42, "42.00"},
+		{Numeric(10, 2), int64(-7), "-7.00"},
+		{Numeric(10, 2), uint8(7), "7.00"},
+		{Numeric(10, 2), big.NewInt(12), "12.00"},
+		{Numeric(10, 2), big.NewRat(1, 3), "0.33"},
+		{Numeric(10, 2), big.NewFloat(2.5), "2.50"},
+		{Numeric(10, 2), "1.5e2", "150.00"},
+		{Numeric(5, 0), "2.5", "3"},
+		{Numeric(0, 0), "1.50", "1.50"},
+		{Numeric(0, 0), "1.5e3", "1500"},
+		{Numeric(0, 0), ".001", "0.001"},
+		{Numeric(0, 0), "123456789012345678901234567890.123456789", "123456789012345678901234567890.123456789"},
+		{Numeric(0, 0), big.NewRat(1, 8), "0.125"},
+		{Numeric(0, 0), big.NewRat(2, 3), "0.6666666666666667"},
+		{Numeric(10, 2), "NaN", "NaN"},
+		{Numeric(0, 0), "Infinity", "Infinity"},
+		{Numeric(0, 0), "-inf", "-Infinity"},
+		{Numeric(0, 0), math.Inf(-1), "-Infinity"},
+	} {
+		v, err := c.k(c.in)
+		if err != nil {
+			t.Errorf("%v: %v", c.in, err)
+			continue
+		}
+		if v.String() != c.out {
+			t.Errorf("expected %v to be %s got: %s", c.in, c.out, v.String())
+		}
+	}
+	for _, in := range []interface{}{"", "1.2.3", "1/3", "0x10", "abc", true} {
+		if _, err := Numeric(10, 2)(in); err == nil {
+			t.Errorf("expected %v to be invalid", in)
+		}
+	}
+	// arithmetic
+	v, _ := Numeric(10, 2)("0.10")
+	sum := new(big.Rat)
+	for i := 0; i < 3; i++ {
+		sum.Add(sum, v.(NumericValue).Rat())
+	}
+	if sum.Cmp(big.NewRat(3, 10)) != 0 {
+		t.Errorf("expected exact sum of 0.30 got: %s", sum.FloatString(2))
+	}
+	v.Scan("NaN")
+	if !v.(NumericValue).NaN() || v.(NumericValue).Rat() != nil {
+		t.Errorf("expected NaN with no Rat")
+	}
+	if err := v.Scan("1.2.3"); err == nil || !v.IsNull() {
+		t.Errorf("expected failed Scan to leave NULL got: %v %s", err, v)
+	}
+	// precision overflow
+	v, err := Numeric(4, 2)("99.995")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := validateValue(v); msg == "" {
+		t.Errorf("expected %s to overflow NUMERIC(4,2)", v)
+	}
+	if _, err := v.Value(); err == nil {
+		t.Errorf("expected overflowing value to be rejected")
+	}
+	v.Scan("Infinity")
+	if msg, _ := validateValue(v); msg == "" {
+		t.Errorf("expected Infinity to overflow NUMERIC(4,2)")
+	}
+	v.Scan("-99.99")
+	if msg, _ := validateValue(v); msg != "" {
+		t.Errorf("expected %s to fit NUMERIC(4,2) got: %s", v, msg)
+	}
+}
+
 func TestTimestampVal(t *testing.T) {
 	v, err := Timestamp("2001-02-03")
 	if err != nil {
@@ -748,7 +926,7 @@ func TestTimestampVal(t *testing.T) {
 	if v.IsNull() {
 		t.Errorf("expected val to not be NULL")
 	}
-	if v.String() != "2001-02-03T00:00:00Z" {
+	if v.String() != "2001-02-03 00:00:00" {
 		t.Errorf("unexpected val: %v", v.Val())
 	}
 	v.Scan(nil)
@@ -760,6 +938,203 @@ func TestTimestampVal(t *testing.T) {
 	}
 }
 
+func TestDateTimeVals(t *testing.T) {
+	for _, c := range []struct {
+		k   Valstructor
+		in  interface{}
+		out string
+	}{
+		{Date, "2001-02-03", "2001-02-03"},
+		{Date, "0044-03-15 BC", "0044-03-15 BC"},
+		{Date, "infinity", "infinity"},
+		{Time, "04:05:06.789", "04:05:06.789"},
+		{Time, "24:00:00", "24:00:00"},
+		{TimeTZ, "04:05:06+05:30", "04:05:06+05:30"},
+		{TimeTZ, "04:05-08", "04:05:00-08"},
+		{Timestamp, "2001-02-03 04:05:06.000001", "2001-02-03 04:05:06.000001"},
+		{Timestamp, "2001-02-03 04:05:06+02", "2001-02-03 04:05:06"},
+		{Timestamp, time.Date(2001, 2, 3, 4, 5, 6, 0, time.FixedZone("", 3600)), "2001-02-03 04:05:06"},
+		{Timestamp, "-infinity", "-infinity"},
+		{TimestampTZ, "2001-02-03 04:05:06.5+05:45", "2001-02-03 04:05:06.5+05:45"},
+		{TimestampTZ, "2001-02-03 04:05:06", "2001-02-03 04:05:06+00"},
+		{TimestampTZ, "0001-01-01 00:00:00+00 BC", "0001-01-01 00:00:00+00 BC"},
+	} {
+		v, err := c.k(c.in)
+		if err != nil {
+			t.Errorf("%v: %v", c.in, err)
+			continue
+		}
+		if v.String() != c.out {
+			t.Errorf("expected %v to be %s got: %s", c.in, c.out, v.String())
+		}
+		// round trip
+		err = v.Scan(v.Val())
+		if err != nil || v.String() != c.out {
+			t.Errorf("expected %v to round trip got: %s %v", c.in, v.String(), err)
+		}
+	}
+	v, _ := TimestampTZ("2001-02-03 04:05:06-03:30")
+	if _, off := v.(TimeValue).Time().Zone(); off != -(3*3600 + 1800) {
+		t.Errorf("expected -03:30 offset got: %d", off)
+	}
+	if v, _ := Date("-infinity"); v.(TimeValue).Infinity() != -1 {
+		t.Errorf("expected -infinity")
+	}
+	for _, bad := range []interface{}{"infinity", "2001-02-03"} {
+		if _, err := Time(bad); err == nil {
+			t.Errorf("expected error for TIME %v", bad)
+		}
+	}
+	if _, err := Date("2001-02-30"); err == nil {
+		t.Errorf("expected error for invalid date")
+	}
+	for _, bad := range []string{"25:00:00", "24:00:01", "24:30:00", "24:00:00.5", "12:60:00", "12:00:60"} {
+		if _, err := Time(bad); err == nil {
+			t.Errorf("expected error for TIME %s", bad)
+		}
+	}
+	for _, bad := range []string{"2001-02-29 24:00:00", "2001-13-01 00:00:00", "2001-02-03 99:00:00"} {
+		if _, err := Timestamp(bad); err == nil {
+			t.Errorf("expected error for TIMESTAMP %s", bad)
+		}
+	}
+	if v, err := Timestamp("2001-02-28 24:00:00"); err != nil || v.String() != "2001-03-01 00:00:00" {
+		t.Errorf("expected 24:00:00 to be midnight at the end of the day got: %v %v", v, err)
+	}
+}
+
+func TestIntervalVal(t *testing.T) {
+	for in, out := range map[string]string{
+		"1 year 2 mons 3 days 04:05:06.789": "1 year 2 mons 3 days 04:05:06.789",
+		"-1 days +02:03:00":                 "-1 days +02:03:00",
+		"00:00:00":                          "00:00:00",
+		"-00:00:01.5":                       "-00:00:01.5",
+		"-14 mons":                          "-1 years -2 mons",
+		"P1Y2M3DT4H5M6.5S":                  "1 year 2 mons 3 days 04:05:06.5",
+		"P-1DT2H":                           "-1 days +02:00:00",
+		"PT36H":                             "36:00:00",
+		"P1W":                               "7 days",
+		"@ 2 hours 30 mins ago":             "-02:30:00",
+		"1.5 mons":                          "1 mon 15 days",
+		"1.5 weeks":                         "10 days 12:00:00",
+		"1.1 mons":                          "1 mon 3 days",
+		"0.05 mons":                         "1 day 12:00:00",
+		"1.5 years":                         "1 year 6 mons",
+	} {
+		v, err := Interval(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if v.String() != out {
+			t.Errorf("expected %s to be %s got: %s", in, out, v.String())
+		}
+		err = v.Scan(v.Val())
+		if err != nil || v.String() != out {
+			t.Errorf("expected %s to round trip got: %s %v", in, v.String(), err)
+		}
+	}
+	v, err := Interval(90*time.Minute + 500*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+	if v.String() != "01:30:00.5" {
+		t.Errorf("unexpected interval from Duration: %s", v.String())
+	}
+	d, err := v.(IntervalValue).Duration()
+	if err != nil || d != 90*time.Minute+500*time.Millisecond {
+		t.Errorf("expected Duration to round trip got: %v %v", d, err)
+	}
+	v.Scan("1 day")
+	if _, err := v.(IntervalValue).Duration(); err == nil {
+		t.Errorf("expected error converting days to a Duration")
+	}
+	if _, err := Interval("1 fortnight"); err == nil {
+		t.Errorf("expected error for unknown unit")
+	}
+	if _, err := Interval("P99999999999999999999D"); err == nil {
+		t.Errorf("expected error for an out of range ISO interval")
+	}
+	if _, err := Interval("1e300 hours"); err == nil {
+		t.Errorf("expected error for an out of range interval")
+	}
+	// nested
+	a, _ := Array(Interval)([]interface{}{"1 day", "-00:00:01"})
+	if a.String() != `{"1 day","-00:00:01"}` {
+		t.Errorf("unexpected interval array: %s", a.String())
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestUUIDVal(t *testing.T) {
+	out := "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+	b := [16]byte{0xa0, 0xee, 0xbc, 0x99, 0x9c, 0x0b, 0x4e, 0xf8,
+		0xbb, 0x6d, 0x6b, 0xb9, 0xbd, 0x38, 0x0a, 0x11}
+	for _, in := range []interface{}{
+		out,
+		"A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11",
+		"{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11}",
+		"a0eebc999c0b4ef8bb6d6bb9bd380a11",
+		[]byte(out),
+		b,
+		b[:],
+	} {
+		v, err := UUID(in)
+		if err != nil {
+			t.Errorf("%v: %v", in, err)
+			continue
+		}
+		if v.String() != out {
+			t.Errorf("expected %v to be %s got: %s", in, out, v.String())
+		}
+		if v.Val() != b {
+			t.Errorf("expected Val to be [16]byte got: %v", v.Val())
+		}
+	}
+	for _, in := range []interface{}{
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1",
+		"a0eebc99x9c0b-4ef8-bb6d-6bb9bd380a11",
+		"g0eebc999c0b4ef8bb6d6bb9bd380a11",
+		"{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+		12,
+	} {
+		if _, err := UUID(in); err == nil {
+			t.Errorf("expected %v to be an invalid UUID", in)
+		}
+	}
+	// a failed Scan leaves the value NULL rather than half decoded
+	v, err := UUID(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Scan("g0eebc999c0b4ef8bb6d6bb9bd380a11"); err == nil || !v.IsNull() {
+		t.Errorf("expected a failed Scan to leave the UUID NULL got: %v %v", err, v)
+	}
+	for ver, gen := range map[int]func() ([16]byte, error){
+		4: NewUUIDv4,
+		7: NewUUIDv7,
+	} {
+		id, err := gen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := UUID(id)
+		if n := v.(UUIDValue).Version(); n != ver {
+			t.Errorf("expected version %d got: %d", ver, n)
+		}
+		if id[8]&0xc0 != 0x80 {
+			t.Errorf("expected RFC 4122 variant got: %x", id[8])
+		}
+	}
+	v, _ = UUID(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
 func TestArrayVal(t *testing.T) {
 	v, err := Array(Int)([]interface{}{1, 2})
 	if err != nil {